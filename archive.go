@@ -0,0 +1,348 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An Archive is a release archive holding the source of
+// a dependency that is not under version control.
+type Archive struct {
+	URL  string // URL or local path of a .tar.gz, .tgz or .zip file
+	Root string // import path of the top directory of the archive
+}
+
+// archiveMarker is the name of the file that marks the top
+// directory of a dependency unpacked from an archive. Its
+// first line is the URL of the archive.
+const archiveMarker = ".godep-archive"
+
+// findArchive looks for archiveMarker in dir and its parents
+// up to srcRoot, and returns the archive it names.
+func findArchive(dir, srcRoot string) (*Archive, error) {
+	dir, srcRoot = filepath.Clean(dir), filepath.Clean(srcRoot)
+	for d := dir; strings.HasPrefix(d, srcRoot+string(filepath.Separator)); d = filepath.Dir(d) {
+		b, err := ioutil.ReadFile(filepath.Join(d, archiveMarker))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		url := strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+		if url == "" {
+			return nil, fmt.Errorf("%s: no archive URL", filepath.Join(d, archiveMarker))
+		}
+		root, err := filepath.Rel(srcRoot, d)
+		if err != nil {
+			return nil, err
+		}
+		return &Archive{URL: url, Root: filepath.ToSlash(root)}, nil
+	}
+	return nil, fmt.Errorf("directory %q is not using a known version control system or archive", dir)
+}
+
+// restoreArchive unpacks a into the first GOPATH entry, after
+// checking the hash of the source of each of deps in it. A
+// directory already in GOPATH is replaced only if it was
+// unpacked from another archive.
+func restoreArchive(a *Archive, deps []Dependency) error {
+	dst := filepath.Join(firstGOPATH(), "src", filepath.FromSlash(a.Root))
+	if old, err := findArchive(dst, filepath.Join(firstGOPATH(), "src")); err == nil && old.Root == a.Root {
+		if old.URL == a.URL {
+			return checkArchive(a, deps, firstGOPATH())
+		}
+	} else if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s: already in GOPATH at %s, not replacing", a.Root, dst)
+	}
+
+	if verbose {
+		fmt.Printf("download %s from %s\n", a.Root, a.URL)
+	}
+	err := os.MkdirAll(firstGOPATH(), 0777)
+	if err != nil {
+		return err
+	}
+	// Unpack next to GOPATH/src, so the tree can be renamed into place.
+	tmp, err := ioutil.TempDir(firstGOPATH(), ".godep-archive")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	top := filepath.Join(tmp, "src", filepath.FromSlash(a.Root))
+	err = unpackArchive(a.URL, top)
+	if err != nil {
+		return fmt.Errorf("%s: %v", a.Root, err)
+	}
+	err = checkArchive(a, deps, tmp)
+	if err != nil {
+		return err
+	}
+	err = writeFile(filepath.Join(top, archiveMarker), a.URL+"\n")
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dst)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0777)
+	if err != nil {
+		return err
+	}
+	return os.Rename(top, dst)
+}
+
+// checkArchive checks the hash of the source of each of deps
+// unpacked from a in the workspace ws.
+func checkArchive(a *Archive, deps []Dependency, ws string) error {
+	for _, dep := range deps {
+		if dep.Hash == "" {
+			continue
+		}
+		dep.ws = ws
+		dep.dir = filepath.Join(ws, "src", filepath.FromSlash(dep.ImportPath))
+		dep.root = a.Root
+		h, err := hashSrc(dep)
+		if err != nil {
+			return err
+		}
+		if h != dep.Hash {
+			return fmt.Errorf("%s: hash of source in %s is %s, want %s", dep.ImportPath, a.URL, h, dep.Hash)
+		}
+	}
+	return nil
+}
+
+// unpackArchive unpacks the archive at url into dir. If all
+// files in the archive are in one top directory, as is usual
+// for release archives, the contents of that directory are
+// unpacked instead.
+func unpackArchive(url, dir string) error {
+	f, err := openArchive(url)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	tmp := dir + ".tmp"
+	defer os.RemoveAll(tmp)
+	switch {
+	case strings.HasSuffix(url, ".zip"):
+		err = unzip(f, tmp)
+	case strings.HasSuffix(url, ".tar.gz"), strings.HasSuffix(url, ".tgz"):
+		err = untar(f, tmp)
+	default:
+		err = fmt.Errorf("unknown archive format: %s", url)
+	}
+	if err != nil {
+		return err
+	}
+	top := tmp
+	if fis, err := ioutil.ReadDir(tmp); err == nil && len(fis) == 1 && fis[0].IsDir() {
+		top = filepath.Join(tmp, fis[0].Name())
+	}
+	// Links may not leave the top directory that is kept.
+	err = checkLinks(top)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dir), 0777)
+	if err != nil {
+		return err
+	}
+	return os.Rename(top, dir)
+}
+
+// openArchive copies the archive at url, which is an http or
+// https URL, a file URL or a local path, to a temporary file.
+// The caller must remove the file.
+func openArchive(url string) (*os.File, error) {
+	var r io.ReadCloser
+	switch {
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("cannot download %s: %s", url, resp.Status)
+		}
+		r = resp.Body
+	default:
+		f, err := os.Open(filepath.FromSlash(strings.TrimPrefix(url, "file://")))
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+	f, err := ioutil.TempFile("", "godep-archive")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, 0)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// archivePath returns the path in dir of the archive member name,
+// or an error if name would be outside dir, or if it is or is
+// inside a symbolic link already unpacked, which could point
+// outside dir.
+func archivePath(dir, name string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(name))
+	if !insideDir(rel) {
+		return "", fmt.Errorf("bad file name in archive: %s", name)
+	}
+	path := dir
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, elem)
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("bad file name in archive: %s is inside symbolic link", name)
+		}
+	}
+	return path, nil
+}
+
+// archiveLink checks that the target of the symbolic link name
+// in an archive is relative and stays inside the archive.
+func archiveLink(name, target string) error {
+	t := filepath.FromSlash(target)
+	if filepath.IsAbs(t) || !insideDir(filepath.Join(filepath.Dir(filepath.FromSlash(name)), t)) {
+		return fmt.Errorf("bad symbolic link in archive: %s -> %s", name, target)
+	}
+	return nil
+}
+
+// checkLinks checks that every symbolic link in the tree at dir
+// stays inside dir.
+func checkLinks(dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return archiveLink(filepath.ToSlash(rel), filepath.ToSlash(target))
+	})
+}
+
+// insideDir reports whether the relative path rel, once cleaned,
+// is the directory it is relative to or names something inside it.
+func insideDir(rel string) bool {
+	rel = filepath.Clean(rel)
+	return !filepath.IsAbs(rel) && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func untar(r io.Reader, dir string) error {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := archivePath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0777)
+		case tar.TypeReg:
+			err = writeArchiveFile(path, tr, os.FileMode(h.Mode))
+		case tar.TypeSymlink:
+			err = archiveLink(h.Name, h.Linkname)
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(path), 0777)
+			}
+			if err == nil {
+				err = os.Symlink(h.Linkname, path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func unzip(f *os.File, dir string) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		path, err := archivePath(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		if zf.FileInfo().IsDir() {
+			err = os.MkdirAll(path, 0777)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(path, r, zf.Mode())
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeArchiveFile(path string, r io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if err1 := w.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
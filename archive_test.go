@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeArchive writes files, keyed by slash-separated name,
+// to a .zip or .tar.gz archive, as given by the suffix of name.
+// In a .tar.gz archive, a file whose contents start with "-> "
+// is a symbolic link to the rest.
+func writeArchive(t *testing.T, name string, files map[string]string) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	err := os.MkdirAll(filepath.Dir(name), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if strings.HasSuffix(name, ".zip") {
+		zw := zip.NewWriter(f)
+		for _, file := range names {
+			w, err := zw.Create(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write([]byte(files[file]))
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, file := range names {
+		h := &tar.Header{
+			Name:     file,
+			Mode:     0644,
+			Size:     int64(len(files[file])),
+			Typeflag: tar.TypeReg,
+		}
+		if strings.HasPrefix(files[file], "-> ") {
+			h.Linkname = strings.TrimPrefix(files[file], "-> ")
+			h.Size = 0
+			h.Typeflag = tar.TypeSymlink
+		}
+		err := tw.WriteHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte(files[file]))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpackArchive(t *testing.T) {
+	var cases = []struct {
+		name  string
+		files map[string]string
+		want  []*node
+		werr  bool
+	}{
+		{ // top directory is stripped
+			name:  "a.tar.gz",
+			files: map[string]string{"d-1.0/main.go": "D", "d-1.0/P/p.go": "P"},
+			want: []*node{
+				{"main.go", "D", nil},
+				{"P/p.go", "P", nil},
+			},
+		},
+		{
+			name:  "a.zip",
+			files: map[string]string{"d-1.0/main.go": "D", "d-1.0/P/p.go": "P"},
+			want: []*node{
+				{"main.go", "D", nil},
+				{"P/p.go", "P", nil},
+			},
+		},
+		{ // no top directory
+			name:  "a.tgz",
+			files: map[string]string{"main.go": "D", "P/p.go": "P"},
+			want: []*node{
+				{"main.go", "D", nil},
+				{"P/p.go", "P", nil},
+			},
+		},
+		{
+			name:  "a.zip",
+			files: map[string]string{"d/../../x.go": "X"},
+			werr:  true,
+		},
+		{
+			name:  "a.rar",
+			files: map[string]string{"main.go": "D"},
+			werr:  true,
+		},
+	}
+
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	for pos, test := range cases {
+		err := os.RemoveAll(scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(scratch, test.name)
+		writeArchive(t, name, test.files)
+		dir := filepath.Join(scratch, "dst")
+		err = unpackArchive(name, dir)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d unpackArchive err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if err == nil {
+			checkTree(t, pos, &node{dir, "", test.want})
+		}
+	}
+}
+
+func TestUnpackArchiveLinks(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scratch = "godeptest"
+	outside := filepath.Join(wd, scratch, "outside")
+	var cases = []struct {
+		files map[string]string
+		werr  bool
+	}{
+		{files: map[string]string{"d/main.go": "D", "d/link.go": "-> main.go"}},
+		{files: map[string]string{"d/main.go": "D", "d/P/link.go": "-> ../main.go"}},
+		{files: map[string]string{"d/link": "-> " + outside, "d/link/pwned.txt": "X"}, werr: true},
+		{files: map[string]string{"d/link": "-> ../../outside", "d/link/pwned.txt": "X"}, werr: true},
+		{files: map[string]string{"d/a/link": "-> ../../outside", "d/b.go": "B"}, werr: true},
+		{files: map[string]string{"d/link": "-> P", "d/link/pwned.txt": "X"}, werr: true},
+	}
+
+	defer os.RemoveAll(scratch)
+	for pos, test := range cases {
+		err := os.RemoveAll(scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.MkdirAll(outside, 0777)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(scratch, "a.tar.gz")
+		writeArchive(t, name, test.files)
+		err = unpackArchive(name, filepath.Join(scratch, "dst"))
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d unpackArchive err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if _, err := os.Lstat(filepath.Join(outside, "pwned.txt")); err == nil {
+			t.Errorf("%d unpackArchive wrote outside its directory", pos)
+		}
+	}
+}
+
+func TestRestoreArchive(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	a1 := &Archive{URL: filepath.Join(wd, gopath, "d-1.0.tar.gz"), Root: "D"}
+	a2 := &Archive{URL: "file://" + filepath.Join(wd, gopath, "d-2.0.zip"), Root: "D"}
+	writeArchive(t, a1.URL, map[string]string{
+		"d-1.0/main.go": pkg("D") + decl("D1"),
+		"d-1.0/P/p.go":  pkg("P") + decl("D1"),
+	})
+	writeArchive(t, strings.TrimPrefix(a2.URL, "file://"), map[string]string{
+		"d-2.0/main.go": pkg("D") + decl("D2"),
+		"d-2.0/P/p.go":  pkg("P") + decl("D2"),
+	})
+	makeTree(t, &node{src, "", []*node{
+		{"C/main.go", pkg("main", "D", "D/P"), nil},
+	}}, "")
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+
+	// Unpack into GOPATH.
+	deps := []Dependency{
+		{ImportPath: "D", Archive: a1},
+		{ImportPath: "D/P", Archive: a1},
+	}
+	err = restoreDeps(deps, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"D/main.go", pkg("D") + decl("D1"), nil},
+		{"D/P/p.go", pkg("P") + decl("D1"), nil},
+		{"D/.godep-archive", a1.URL + "\n", nil},
+	}})
+
+	// Save records the archive and copies all its files.
+	err = os.Chdir(filepath.Join(src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	err = save(nil)
+	os.Chdir(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 1, &node{src, "", []*node{
+		{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+		{"C/Godeps/_workspace/src/D/P/p.go", pkg("P") + decl("D1"), nil},
+		{"C/Godeps/_workspace/src/D/.godep-archive", "(absent)", nil},
+	}})
+	err = os.Chdir(filepath.Join(src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	g, err := loadDefaultGodepsFile()
+	os.Chdir(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Deps) != 1 || g.Deps[0].Archive == nil || *g.Deps[0].Archive != *a1 || g.Deps[0].Rev != "" || g.Deps[0].Hash == "" {
+		t.Fatalf("saved deps = %+v want D from %v with hash", g.Deps, a1)
+	}
+
+	// A hash mismatch leaves GOPATH alone.
+	deps = []Dependency{{ImportPath: "D", Archive: a2, Hash: g.Deps[0].Hash}}
+	log.SetOutput(ioutil.Discard)
+	err = restoreDeps(deps, 1)
+	log.SetOutput(os.Stderr)
+	if err == nil {
+		t.Error("restoreDeps with wrong hash err = nil want error")
+	}
+	checkTree(t, 2, &node{src, "", []*node{
+		{"D/main.go", pkg("D") + decl("D1"), nil},
+	}})
+
+	// Another archive replaces the first.
+	deps[0].Hash = ""
+	err = restoreDeps(deps, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 3, &node{src, "", []*node{
+		{"D/main.go", pkg("D") + decl("D2"), nil},
+		{"D/.godep-archive", a2.URL + "\n", nil},
+	}})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tools/godep/Godeps/_workspace/src/golang.org/x/tools/go/vcs"
+)
+
+var cmdCache = &Command{
+	Usage: "cache [-age duration] list|verify|prune",
+	Short: "manage the cache of downloaded repositories",
+	Long: `
+If the environment variable GODEP_CACHE is set, restore and get keep a
+bare mirror of each repository they download in that directory. Later
+downloads of the same repository fetch new commits into the mirror and
+clone from it, rather than downloading the whole repository again.
+The cloned repositories still use the original URL as their remote.
+
+Cache manages the mirrors.
+
+List prints the URL, version control system and time of last use
+of each mirror.
+
+Verify checks the integrity of each mirror, and prints the ones that
+are damaged.
+
+Prune removes the mirrors that have not been used for longer than
+-age (default 720h, 30 days).
+`,
+	Run: runCache,
+}
+
+var cacheAge time.Duration
+
+func init() {
+	cmdCache.Flag.DurationVar(&cacheAge, "age", 30*24*time.Hour, "prune mirrors unused for this long")
+}
+
+func runCache(cmd *Command, args []string) {
+	if len(args) != 1 {
+		cmd.UsageExit()
+	}
+	if cacheRoot() == "" {
+		log.Fatalln("GODEP_CACHE is not set")
+	}
+	a, err := listCache()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	switch args[0] {
+	case "list":
+		for _, e := range a {
+			fmt.Printf("%s %s %s\n", e.URL, e.vcs.vcs.Cmd, e.Used.Format("2006-01-02 15:04"))
+		}
+	case "verify":
+		hadError := false
+		for _, e := range a {
+			if err := e.vcs.run(e.Dir, e.vcs.VerifyCmd); err != nil {
+				fmt.Println("damaged:", e.URL)
+				hadError = true
+			}
+		}
+		if hadError {
+			os.Exit(1)
+		}
+	case "prune":
+		if err := pruneCache(a, time.Now().Add(-cacheAge)); err != nil {
+			log.Fatalln(err)
+		}
+	default:
+		cmd.UsageExit()
+	}
+}
+
+// cacheRoot returns the directory of the repository cache,
+// or "" if the cache is not in use.
+func cacheRoot() string {
+	return os.Getenv("GODEP_CACHE")
+}
+
+// A cacheEntry is a mirror in the repository cache.
+type cacheEntry struct {
+	URL  string
+	Dir  string
+	Used time.Time // time of last use
+	vcs  *VCS
+}
+
+// cacheDir returns the directory of the mirror of repo.
+func cacheDir(v *VCS, repo string) string {
+	return filepath.Join(cacheRoot(), v.vcs.Cmd, url.QueryEscape(repo))
+}
+
+// listCache returns the mirrors in the cache, sorted by URL.
+func listCache() ([]cacheEntry, error) {
+	var a []cacheEntry
+	for _, v := range cmd {
+		fis, err := ioutil.ReadDir(filepath.Join(cacheRoot(), v.vcs.Cmd))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			repo, err := url.QueryUnescape(fi.Name())
+			if err != nil || !fi.IsDir() {
+				continue // not ours
+			}
+			a = append(a, cacheEntry{
+				URL:  repo,
+				Dir:  filepath.Join(cacheRoot(), v.vcs.Cmd, fi.Name()),
+				Used: fi.ModTime(),
+				vcs:  v,
+			})
+		}
+	}
+	sort.Sort(byURL(a))
+	return a, nil
+}
+
+type byURL []cacheEntry
+
+func (a byURL) Len() int           { return len(a) }
+func (a byURL) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byURL) Less(i, j int) bool { return a[i].URL < a[j].URL }
+
+// pruneCache removes the mirrors in a last used before t.
+func pruneCache(a []cacheEntry, t time.Time) error {
+	for _, e := range a {
+		if e.Used.Before(t) {
+			if verbose {
+				fmt.Println("remove", e.URL)
+			}
+			if err := os.RemoveAll(e.Dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cloneFromCache creates the repository repo in dir by cloning
+// it from its mirror in the cache, creating or updating the
+// mirror first. The clone's default remote is set to repo.
+func cloneFromCache(v *VCS, repo, dir string) error {
+	mirror, err := updateMirror(v, repo)
+	if err != nil {
+		return err
+	}
+	err = v.vcs.Create(dir, mirror)
+	if err != nil {
+		return err
+	}
+	return v.setRemote(dir, repo)
+}
+
+// updateMirror creates the mirror of repo in the cache, or fetches
+// new commits into it if it exists, and returns its directory.
+func updateMirror(v *VCS, repo string) (string, error) {
+	mirror := cacheDir(v, repo)
+	var err error
+	if _, err = os.Stat(mirror); err == nil {
+		err = v.run(mirror, v.FetchCmd)
+	} else {
+		err = os.MkdirAll(filepath.Dir(mirror), 0777)
+		if err == nil {
+			err = v.run(".", v.MirrorCmd, "repo", repo, "dir", mirror)
+		}
+		if err != nil {
+			os.RemoveAll(mirror)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot update mirror of %s: %v", repo, err)
+	}
+	now := time.Now()
+	os.Chtimes(mirror, now, now) // record use; ignore error
+	return mirror, nil
+}
+
+// createRepo creates the repository repo in dir, using the
+// cache if it is in use and falling back to a direct download
+// if the cache fails.
+func createRepo(c *vcs.Cmd, repo, dir string) error {
+	if v := cmd[c]; v != nil && v.MirrorCmd != "" && cacheRoot() != "" {
+		err := cloneFromCache(v, repo, dir)
+		if err == nil {
+			return nil
+		}
+		log.Println(err)
+		os.RemoveAll(dir)
+	}
+	return c.Create(dir, repo)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tools/godep/Godeps/_workspace/src/golang.org/x/tools/go/vcs"
+)
+
+func TestCloneFromCache(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("GODEP_CACHE", os.Getenv("GODEP_CACHE"))
+	err = os.Setenv("GODEP_CACHE", filepath.Join(wd, gopath, "cache"))
+	if err != nil {
+		panic(err)
+	}
+	upstream := filepath.Join(wd, gopath, "upstream")
+	src := filepath.Join(wd, gopath, "src")
+	makeTree(t, &node{upstream, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D1"), nil},
+				{"+git", "D1", nil},
+			},
+		},
+	}}, "")
+	repo := "file://" + filepath.Join(upstream, "D")
+	v := cmd[vcs.ByCmd("git")]
+
+	// The first clone creates the mirror.
+	err = createRepo(v.vcs, repo, filepath.Join(src, "D1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"D1/main.go", pkg("D") + decl("D1"), nil},
+	}})
+	if g := strings.TrimSpace(run(t, filepath.Join(src, "D1"), "git", "config", "remote.origin.url")); g != repo {
+		t.Errorf("remote = %q want %q", g, repo)
+	}
+
+	// The second clone gets new commits into the mirror.
+	makeTree(t, &node{upstream, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D2"), nil},
+				{"+git", "D2", nil},
+			},
+		},
+	}}, "")
+	err = createRepo(v.vcs, repo, filepath.Join(src, "D2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 1, &node{src, "", []*node{
+		{"D2/main.go", pkg("D") + decl("D2"), nil},
+	}})
+
+	a, err := listCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 1 || a[0].URL != repo || a[0].vcs != v {
+		t.Fatalf("listCache = %+v want one entry for %s", a, repo)
+	}
+	err = v.run(a[0].Dir, v.VerifyCmd)
+	if err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	err = pruneCache(a, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fis, _ := ioutil.ReadDir(filepath.Join(wd, gopath, "cache", "git")); len(fis) != 1 {
+		t.Errorf("prune of recently used mirror left %d entries, want 1", len(fis))
+	}
+	err = pruneCache(a, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ = listCache(); len(a) != 0 {
+		t.Errorf("listCache after prune = %+v want none", a)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/tools/godep/Godeps/_workspace/src/golang.org/x/tools/go/vcs"
+)
+
+// A Config is the user configuration of godep. It is read from
+// the file named by $GODEP_CONFIG or, if that is not set, from
+// $HOME/.godep/config.json. A missing file is an empty Config.
+type Config struct {
+	Mirrors []Mirror
+	VCS     map[string]*VCSConfig // by command name, such as git
+}
+
+// A Mirror replaces the repository URL of the import paths
+// starting with Prefix.
+type Mirror struct {
+	Prefix string // import path prefix, such as github.com/
+	URL    string // URL that replaces Prefix, such as https://git.example.com/mirror/
+	VCS    string `json:",omitempty"` // git, hg, bzr or svn; needed if godep cannot tell
+}
+
+// A VCSConfig overrides the command templates of a version
+// control system, or defines a new one. Empty templates are
+// left as they are.
+type VCSConfig struct {
+	VCS
+
+	// Needed only for new systems.
+	Marker      string // file or directory in the root of a repository
+	CreateCmd   string // creates a checkout of {repo} in {dir}
+	DownloadCmd string // fetches new commits from the default remote
+}
+
+// configFile returns the name of the configuration file.
+func configFile() string {
+	if s := os.Getenv("GODEP_CONFIG"); s != "" {
+		return s
+	}
+	return filepath.Join(os.Getenv("HOME"), ".godep", "config.json")
+}
+
+// loadConfig reads the configuration file.
+func loadConfig() (*Config, error) {
+	c := new(Config)
+	name := configFile()
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return c, nil
+}
+
+// mirror returns the mirror with the longest prefix
+// of importPath, or nil if there is none.
+func (c *Config) mirror(importPath string) *Mirror {
+	var best *Mirror
+	for i := range c.Mirrors {
+		m := &c.Mirrors[i]
+		if !hasPathPrefix(importPath, strings.TrimSuffix(m.Prefix, "/")) {
+			continue
+		}
+		if best == nil || len(m.Prefix) > len(best.Prefix) {
+			best = m
+		}
+	}
+	return best
+}
+
+// hasPathPrefix reports whether the import path s
+// is prefix or begins with prefix followed by a slash.
+func hasPathPrefix(s, prefix string) bool {
+	return s == prefix || strings.HasPrefix(s, prefix+"/")
+}
+
+// repoRootForImportPath is like vcs.RepoRootForImportPath,
+// but uses the mirrors in the configuration file.
+//
+// If importPath is on a site that godep knows, such as
+// github.com, its repository root is found as usual and
+// the mirror prefix in the root is replaced by the mirror
+// URL. Otherwise the mirror prefix is the repository root,
+// and the mirror URL is the repository.
+func repoRootForImportPath(importPath string) (*vcs.RepoRoot, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	m := c.mirror(importPath)
+	if m == nil {
+		return vcs.RepoRootForImportPath(importPath, verbose)
+	}
+	prefix := strings.TrimSuffix(m.Prefix, "/")
+	repo := strings.TrimSuffix(m.URL, "/")
+	rr, err := vcs.RepoRootForImportPathStatic(importPath, "https")
+	if err == nil && hasPathPrefix(rr.Root, prefix) {
+		rr.Repo = repo + strings.TrimPrefix(rr.Root, prefix)
+	} else {
+		rr = &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: repo, Root: prefix}
+	}
+	if m.VCS != "" {
+		rr.VCS = vcsByCmd(m.VCS)
+		if rr.VCS == nil {
+			return nil, fmt.Errorf("mirror %s: unknown version control system %q", m.Prefix, m.VCS)
+		}
+	}
+	if verbose {
+		fmt.Printf("%s: using mirror %s\n", importPath, rr.Repo)
+	}
+	return rr, nil
+}
+
+// vcsByCmd returns the version control system
+// with the given command name, or nil.
+func vcsByCmd(name string) *vcs.Cmd {
+	for c := range cmd {
+		if c.Cmd == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// A vcsMarker is the file or directory that marks the
+// root of a repository of a system defined in the
+// configuration file.
+type vcsMarker struct {
+	name string
+	vcs  *VCS
+}
+
+var vcsMarkers []vcsMarker
+
+// loadVCSConfig registers the version control systems
+// in the configuration file.
+func loadVCSConfig() error {
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	return c.registerVCS()
+}
+
+// registerVCS applies the version control systems in c
+// to the known ones, adding those that are new.
+func (c *Config) registerVCS() error {
+	for name, vc := range c.VCS {
+		var v *VCS
+		if vcmd := vcsByCmd(name); vcmd != nil {
+			v = cmd[vcmd]
+		} else {
+			if vc.Marker == "" || vc.CreateCmd == "" {
+				return fmt.Errorf("%s: new version control system %s needs Marker and CreateCmd", configFile(), name)
+			}
+			v = &VCS{vcs: &vcs.Cmd{
+				Name:        name,
+				Cmd:         name,
+				CreateCmd:   vc.CreateCmd,
+				DownloadCmd: vc.DownloadCmd,
+			}}
+			cmd[v.vcs] = v
+			vcsMarkers = append(vcsMarkers, vcsMarker{vc.Marker, v})
+		}
+		// Copy the templates that are set.
+		dst, src := reflect.ValueOf(v).Elem(), reflect.ValueOf(&vc.VCS).Elem()
+		for i := 0; i < src.NumField(); i++ {
+			f := src.Field(i)
+			if f.Kind() == reflect.String && f.CanInterface() && f.String() != "" {
+				dst.Field(i).SetString(f.String())
+			}
+		}
+	}
+	return nil
+}
+
+// fromDirMarkers is like vcs.FromDir, for the systems
+// defined in the configuration file.
+func fromDirMarkers(dir, srcRoot string) (*VCS, string, bool) {
+	dir, srcRoot = filepath.Clean(dir), filepath.Clean(srcRoot)
+	for d := dir; strings.HasPrefix(d, srcRoot+string(filepath.Separator)); d = filepath.Dir(d) {
+		for _, m := range vcsMarkers {
+			if _, err := os.Stat(filepath.Join(d, m.name)); err == nil {
+				return m.vcs, d[len(srcRoot)+1:], true
+			}
+		}
+	}
+	return nil, "", false
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setConfig writes c to a configuration file in dir and points
+// GODEP_CONFIG at it. It returns a function that restores the
+// previous setting.
+func setConfig(t *testing.T, dir string, c *Config) func() {
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(name, b, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Getenv("GODEP_CONFIG")
+	os.Setenv("GODEP_CONFIG", name)
+	return func() { os.Setenv("GODEP_CONFIG", old) }
+}
+
+func TestRepoRootForImportPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godep-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setConfig(t, dir, &Config{Mirrors: []Mirror{
+		{Prefix: "github.com/", URL: "https://git.example.com/mirror/"},
+		{Prefix: "github.com/a/special", URL: "ssh://git.example.com/special.git"},
+		{Prefix: "golang.org/x/net", URL: "https://git.example.com/x/net"},
+		{Prefix: "example.org/hg", URL: "https://hg.example.com/hg", VCS: "hg"},
+	}})()
+
+	var cases = []struct {
+		path string
+		root string
+		repo string
+		vcs  string
+	}{
+		{"github.com/a/b", "github.com/a/b", "https://git.example.com/mirror/a/b", "git"},
+		{"github.com/a/b/c/d", "github.com/a/b", "https://git.example.com/mirror/a/b", "git"},
+		{"github.com/a/special/c", "github.com/a/special", "ssh://git.example.com/special.git", "git"},
+		{"golang.org/x/net/context", "golang.org/x/net", "https://git.example.com/x/net", "git"},
+		{"example.org/hg/p", "example.org/hg", "https://hg.example.com/hg", "hg"},
+	}
+	for _, test := range cases {
+		rr, err := repoRootForImportPath(test.path)
+		if err != nil {
+			t.Errorf("repoRootForImportPath(%q) err = %v", test.path, err)
+			continue
+		}
+		if rr.Root != test.root || rr.Repo != test.repo || rr.VCS.Cmd != test.vcs {
+			t.Errorf("repoRootForImportPath(%q) = %s %s %s want %s %s %s",
+				test.path, rr.Root, rr.Repo, rr.VCS.Cmd, test.root, test.repo, test.vcs)
+		}
+	}
+}
+
+func TestRestoreFromMirror(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := filepath.Join(wd, gopath, "upstream")
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{upstream, "", []*node{
+		{
+			"a/D",
+			"",
+			[]*node{
+				{"P/main.go", pkg("P") + decl("D1"), nil},
+				{"+git", "D1", nil},
+				{"P/main.go", pkg("P") + decl("D2"), nil},
+				{"+git", "D2", nil},
+			},
+		},
+		{
+			"E",
+			"",
+			[]*node{
+				{"main.go", pkg("E") + decl("E1"), nil},
+				{"+git", "E1", nil},
+			},
+		},
+	}}, "")
+	err = os.MkdirAll(src, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setConfig(t, filepath.Join(wd, gopath), &Config{Mirrors: []Mirror{
+		{Prefix: "github.com/", URL: "file://" + upstream},
+		{Prefix: "example.com/E", URL: "file://" + filepath.Join(upstream, "E")},
+	}})()
+	rev := func(dir, tag string) string {
+		return strings.TrimSpace(run(t, dir, "git", "rev-parse", tag))
+	}
+	deps := []Dependency{
+		{ImportPath: "github.com/a/D/P", Rev: rev(filepath.Join(upstream, "a", "D"), "D1")},
+		{ImportPath: "example.com/E", Rev: rev(filepath.Join(upstream, "E"), "E1")},
+	}
+
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	log.SetOutput(ioutil.Discard)
+	err = restoreDeps(deps, 2)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"github.com/a/D/P/main.go", pkg("P") + decl("D1"), nil},
+		{"example.com/E/main.go", pkg("E") + decl("E1"), nil},
+	}})
+}
+
+// fakeVCS is a minimal version control system for tests. The
+// root of a repository holds a directory named .fake, and the
+// revision is in .fake/rev.
+const fakeVCS = `#!/bin/sh
+root=$(pwd)
+while [ ! -d "$root/.fake" ]; do root=$(dirname "$root"); done
+case $1 in
+rev) cat "$root/.fake/rev" ;;
+root) echo "$root" ;;
+list) cd "$root" && find . -type f ! -path './.fake/*' | sed 's|^\./||' ;;
+diff) ;;
+esac
+`
+
+func TestRegisterVCS(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(wd, gopath, "bin")
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{filepath.Join(wd, gopath), "", []*node{
+		{"bin/fakevcs", fakeVCS, nil},
+		{"src/D/main.go", pkg("D") + decl("D1"), nil},
+		{"src/D/.fake/rev", "r1\n", nil},
+		{"src/C/main.go", pkg("main", "D"), nil},
+	}}, "")
+	err = os.Chmod(filepath.Join(bin, "fakevcs"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	oldGit := *vcsGit
+	defer func() {
+		*vcsGit = oldGit
+		for c := range cmd {
+			if c.Cmd == "fakevcs" {
+				delete(cmd, c)
+			}
+		}
+		vcsMarkers = nil
+	}()
+	c := &Config{VCS: map[string]*VCSConfig{
+		"git": {VCS: VCS{DescribeCmd: "describe --tags --always"}},
+		"fakevcs": {
+			VCS: VCS{
+				IdentifyCmd: "rev",
+				DescribeCmd: "rev",
+				DiffCmd:     "diff {rev}",
+				ListCmd:     "list",
+				RootCmd:     "root",
+			},
+			Marker:    ".fake",
+			CreateCmd: "create {repo} {dir}",
+		},
+	}}
+	err = c.registerVCS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vcsGit.DescribeCmd != "describe --tags --always" || vcsGit.IdentifyCmd != oldGit.IdentifyCmd {
+		t.Errorf("git templates = %q, %q want override of DescribeCmd only", vcsGit.DescribeCmd, vcsGit.IdentifyCmd)
+	}
+	err = (&Config{VCS: map[string]*VCSConfig{"other": {}}}).registerVCS()
+	if err == nil {
+		t.Error("registerVCS of new system without Marker err = nil want error")
+	}
+
+	err = os.Chdir(filepath.Join(src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	err = save(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Deps) != 1 || g.Deps[0].Rev != "r1" || g.Deps[0].Comment != "r1" {
+		t.Errorf("saved deps = %+v want D at r1", g.Deps)
+	}
+	checkTree(t, 0, &node{filepath.Join(wd, src), "", []*node{
+		{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+		{"C/Godeps/_workspace/src/D/.fake/rev", "(absent)", nil},
+	}})
+}
@@ -10,8 +10,15 @@ import (
 // A Dependency is a specific revision of a package.
 type Dependency struct {
 	ImportPath string
-	Comment    string `json:",omitempty"` // Description of commit, if present.
-	Rev        string // VCS-specific commit ID.
+	Comment    string      `json:",omitempty"` // Description of commit, if present.
+	Rev        string      // VCS-specific commit ID.
+	Hash       string      `json:",omitempty"` // Hash of the copied source, if present.
+	Repo       string      `json:",omitempty"` // Repository URL, if not the usual one for ImportPath.
+	Archive    *Archive    `json:",omitempty"` // Source archive, if not under version control.
+	Submodules []Submodule `json:",omitempty"` // Nested repositories, if any.
+	LFS        string      `json:",omitempty"` // Policy for Git LFS pointer files: "fetch", "keep", or fail if empty.
+	Dirty      string      `json:",omitempty"` // Hash of uncommitted changes copied with Rev, if any.
+	Patches    []Patch     `json:",omitempty"` // Patches applied to the copied source, if any.
 
 	// used by command save & update
 	ws   string // workspace
@@ -19,11 +26,21 @@ type Dependency struct {
 	dir  string // full path to package
 
 	// used by command update
-	matched bool // selected for update by command line
+	matched bool   // selected for update by command line
+	wantRev string // revision requested on command line, if any
 	pkg     *Package
 
 	// used by command go
 	vcs *VCS
+
+	archive *Archive // archive in GOPATH, if vcs is nil
+}
+
+// A Submodule is a repository nested in the
+// repository of a dependency.
+type Submodule struct {
+	Path string // Slash-separated, relative to the dependency's directory.
+	Rev  string // VCS-specific commit ID.
 }
 
 func eqDeps(a, b []Dependency) bool {
@@ -2,59 +2,191 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/tools/godep/Godeps/_workspace/src/github.com/pmezard/go-difflib/difflib"
 )
 
 var cmdDiff = &Command{
-	Usage: "diff",
+	Usage: "diff [-json] [-log] [rev1 [rev2]]",
 	Short: "shows the diff between current and previously saved set of dependencies",
 	Long: `
 Shows the difference, in a unified diff format, between the
 current set of dependencies and those generated on a
 previous 'go save' execution.
+
+If revisions are given, the Godeps files saved at those revisions
+of the repository containing Godeps are compared instead, without
+looking at GOPATH. If only rev1 is given, the Godeps file saved
+at rev1 is compared with the one on disk. Git, Mercurial, Bazaar
+and Subversion repositories are supported.
+
+If -json is given, the difference is printed as a JSON document
+with the following structure:
+
+	type Diff struct {
+		GoVersion *struct {
+			Old string
+			New string
+		}
+		Packages *struct {
+			Added   []string
+			Removed []string
+		}
+		Added   []Dependency // As in Godeps.json.
+		Removed []Dependency
+		Changed []struct {
+			ImportPath string
+			Old        struct {
+				Rev     string
+				Comment string
+			}
+			New struct {
+				Rev     string
+				Comment string
+			}
+			Log string // Upstream commits, if -log is given.
+		}
+	}
+
+Fields without changes are omitted.
+
+If -log is given, the upstream commits between the old and new
+revision of each changed dependency are printed after the diff,
+one per line. They are read from the dependency's repository in
+GOPATH, so it must contain both revisions.
 `,
 	Run: runDiff,
 }
 
+var diffJSON, diffLog bool
+
+func init() {
+	cmdDiff.Flag.BoolVar(&diffJSON, "json", false, "print the difference as JSON")
+	cmdDiff.Flag.BoolVar(&diffLog, "log", false, "print upstream commits of changed dependencies")
+}
+
 func runDiff(cmd *Command, args []string) {
-	gold, err := loadDefaultGodepsFile()
+	var gold, gnew Godeps
+	var from, to string
+	var err error
+	switch len(args) {
+	case 0:
+		gold, gnew, err = loadDiffGOPATH()
+		from, to = gnew.file(), "$GOPATH"
+	case 1, 2:
+		gold, gnew, err = loadDiffRevs(args)
+		from = args[0] + ":" + godepsFile
+		to = godepsFile
+		if len(args) == 2 {
+			to = args[1] + ":" + godepsFile
+		}
+	default:
+		cmd.UsageExit()
+	}
 	if err != nil {
 		log.Fatalln(err)
 	}
 
+	d := diffGodeps(&gold, &gnew)
+	if diffLog {
+		addLogs(d.Changed)
+	}
+	if diffJSON {
+		b, err := json.MarshalIndent(d, "", "\t")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
+		return
+	}
+
+	diff, err := diffNamed(&gold, &gnew, from, to)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println(diff)
+	for _, c := range d.Changed {
+		if c.Log != "" {
+			fmt.Printf("%s %s..%s\n%s\n", c.ImportPath, c.Old.Rev, c.New.Rev, c.Log)
+		}
+	}
+}
+
+// loadDiffGOPATH returns the saved Godeps and the Godeps
+// computed from the dependencies in GOPATH.
+func loadDiffGOPATH() (gold, gnew Godeps, err error) {
+	gold, err = loadDefaultGodepsFile()
+	if err != nil {
+		return gold, gnew, err
+	}
+
 	pkgs := []string{"."}
 	dot, err := LoadPackages(pkgs...)
 	if err != nil {
-		log.Fatalln(err)
+		return gold, gnew, err
 	}
 
 	ver, err := goVersion()
 	if err != nil {
-		log.Fatalln(err)
+		return gold, gnew, err
 	}
 
-	gnew := &Godeps{
+	gnew = Godeps{
 		ImportPath: dot[0].ImportPath,
 		GoVersion:  ver,
+		prev:       gold.Deps,
+		diffOnly:   true,
 	}
 
 	err = gnew.fill(dot, dot[0].ImportPath)
 	if err != nil {
-		log.Fatalln(err)
+		return gold, gnew, err
 	}
+	err = setPatches(gnew.Deps)
+	return gold, gnew, err
+}
 
-	diff, err := diffStr(&gold, gnew)
+// loadDiffRevs returns the Godeps saved at revision revs[0] of
+// the repository containing Godeps, and the Godeps saved at
+// revs[1], or on disk if revs has only one element.
+func loadDiffRevs(revs []string) (gold, gnew Godeps, err error) {
+	dir, isDir := findGodeps()
+	if dir == "" || !isDir {
+		return gold, gnew, fmt.Errorf("no %s found", godepsFile)
+	}
+	dot, err := LoadPackages(".")
 	if err != nil {
-		log.Fatalln(err)
+		return gold, gnew, err
 	}
-	fmt.Println(diff)
+	v, _, err := VCSFromDir(dir, filepath.Join(dot[0].Root, "src"))
+	if err != nil {
+		return gold, gnew, err
+	}
+	gold, err = loadGodepsRev(v, dir, revs[0])
+	if err != nil {
+		return gold, gnew, err
+	}
+	if len(revs) == 2 {
+		gnew, err = loadGodepsRev(v, dir, revs[1])
+	} else {
+		gnew, err = loadGodepsFile(filepath.Join(dir, godepsFile))
+	}
+	return gold, gnew, err
 }
 
 // diffStr returns a unified diff string of two Godeps.
 func diffStr(a, b *Godeps) (string, error) {
+	return diffNamed(a, b, b.file(), "$GOPATH")
+}
+
+// diffNamed returns a unified diff string of two Godeps,
+// labeled with the names from and to.
+func diffNamed(a, b *Godeps, from, to string) (string, error) {
 	var ab, bb bytes.Buffer
 
 	_, err := a.writeTo(&ab)
@@ -70,9 +202,106 @@ func diffStr(a, b *Godeps) (string, error) {
 	diff := difflib.UnifiedDiff{
 		A:        difflib.SplitLines(ab.String()),
 		B:        difflib.SplitLines(bb.String()),
-		FromFile: b.file(),
-		ToFile:   "$GOPATH",
+		FromFile: from,
+		ToFile:   to,
 		Context:  10,
 	}
 	return difflib.GetUnifiedDiffString(diff)
 }
+
+// A godepsDiff is the set of changes between two Godeps.
+type godepsDiff struct {
+	GoVersion *versionChange  `json:",omitempty"`
+	Packages  *packagesChange `json:",omitempty"`
+	Added     []Dependency    `json:",omitempty"`
+	Removed   []Dependency    `json:",omitempty"`
+	Changed   []depChange     `json:",omitempty"`
+}
+
+type versionChange struct {
+	Old, New string
+}
+
+type packagesChange struct {
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+}
+
+type depChange struct {
+	ImportPath string
+	Old, New   depVersion
+	Log        string `json:",omitempty"`
+}
+
+type depVersion struct {
+	Rev     string
+	Comment string `json:",omitempty"`
+}
+
+// diffGodeps returns the changes needed to turn a into b.
+// Dependencies are matched by import path.
+func diffGodeps(a, b *Godeps) *godepsDiff {
+	d := new(godepsDiff)
+	if a.GoVersion != b.GoVersion {
+		d.GoVersion = &versionChange{Old: a.GoVersion, New: b.GoVersion}
+	}
+	added := subStrings(b.Packages, a.Packages)
+	removed := subStrings(a.Packages, b.Packages)
+	if added != nil || removed != nil {
+		d.Packages = &packagesChange{Added: added, Removed: removed}
+	}
+
+	d.Added = subDeps(b.Deps, a.Deps)
+	d.Removed = subDeps(a.Deps, b.Deps)
+	old := make(map[string]Dependency)
+	for _, dep := range a.Deps {
+		old[dep.ImportPath] = dep
+	}
+	for _, dep := range b.Deps {
+		o, ok := old[dep.ImportPath]
+		if ok && (o.Rev != dep.Rev || o.Comment != dep.Comment) {
+			d.Changed = append(d.Changed, depChange{
+				ImportPath: dep.ImportPath,
+				Old:        depVersion{Rev: o.Rev, Comment: o.Comment},
+				New:        depVersion{Rev: dep.Rev, Comment: dep.Comment},
+			})
+		}
+	}
+	return d
+}
+
+// subStrings returns the strings in a that are not in b.
+func subStrings(a, b []string) (diff []string) {
+Diff:
+	for _, sa := range a {
+		for _, sb := range b {
+			if sa == sb {
+				continue Diff
+			}
+		}
+		diff = append(diff, sa)
+	}
+	return diff
+}
+
+// addLogs sets the Log of each change in changes to the
+// upstream commits between its old and new revision, taken
+// from the dependency's repository in GOPATH. Changes whose
+// repository or revisions cannot be found are left alone.
+func addLogs(changes []depChange) {
+	deps := make([]Dependency, len(changes))
+	for i, c := range changes {
+		deps[i].ImportPath = c.ImportPath
+	}
+	loadDeps(deps) // errors are logged; such deps have no vcs
+	for i, dep := range deps {
+		if dep.vcs == nil {
+			continue
+		}
+		s, err := dep.vcs.log(dep.dir, changes[i].Old.Rev, changes[i].New.Rev)
+		if err != nil {
+			continue // runOutput printed the error
+		}
+		changes[i].Log = s
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -87,6 +90,186 @@ func TestDiff(t *testing.T) {
 	}
 }
 
+func TestDiffGodeps(t *testing.T) {
+	a := &Godeps{
+		ImportPath: "C",
+		GoVersion:  "go1.4",
+		Packages:   []string{"./..."},
+		Deps: []Dependency{
+			{ImportPath: "D", Comment: "D1", Rev: "d1"},
+			{ImportPath: "E", Rev: "e1"},
+			{ImportPath: "F", Comment: "F1", Rev: "f1"},
+		},
+	}
+	var cases = []struct {
+		b    *Godeps
+		want *godepsDiff
+	}{
+		{
+			b:    a,
+			want: &godepsDiff{},
+		},
+		{
+			b: &Godeps{
+				ImportPath: "C",
+				GoVersion:  "go1.5",
+				Packages:   []string{"C/cmd/...", "./..."},
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D2", Rev: "d2"},
+					{ImportPath: "E", Rev: "e1"},
+					{ImportPath: "G", Rev: "g1"},
+				},
+			},
+			want: &godepsDiff{
+				GoVersion: &versionChange{Old: "go1.4", New: "go1.5"},
+				Packages:  &packagesChange{Added: []string{"C/cmd/..."}},
+				Added:     []Dependency{{ImportPath: "G", Rev: "g1"}},
+				Removed:   []Dependency{{ImportPath: "F", Comment: "F1", Rev: "f1"}},
+				Changed: []depChange{
+					{
+						ImportPath: "D",
+						Old:        depVersion{Rev: "d1", Comment: "D1"},
+						New:        depVersion{Rev: "d2", Comment: "D2"},
+					},
+				},
+			},
+		},
+	}
+	for pos, test := range cases {
+		g := diffGodeps(a, test.b)
+		if !reflect.DeepEqual(g, test.want) {
+			t.Errorf("%d diffGodeps = %+v want %+v", pos, g, test.want)
+		}
+	}
+}
+
+func TestLoadDiffRevs(t *testing.T) {
+	start := []*node{
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main"), nil},
+				{"Godeps/Godeps.json", godepsJSON("C", "D", "D1"), nil},
+				{"+git", "c1", nil},
+				{"Godeps/Godeps.json", godepsJSON("C", "D", "D2", "E", "E1"), nil},
+				{"+git", "c2", nil},
+				{"Godeps/Godeps.json", godepsJSON("C", "E", "E1"), nil},
+			},
+		},
+	}
+	var cases = []struct {
+		revs       []string
+		wold, wnew *Godeps
+		werr       bool
+	}{
+		{
+			revs: []string{"c1", "c2"},
+			wold: godeps("C", "D", "D1"),
+			wnew: godeps("C", "D", "D2", "E", "E1"),
+		},
+		{
+			revs: []string{"c2"},
+			wold: godeps("C", "D", "D2", "E", "E1"),
+			wnew: godeps("C", "E", "E1"),
+		},
+		{
+			revs: []string{"nosuchrev"},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", start}, "")
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	for pos, test := range cases {
+		gold, gnew, err := loadDiffRevs(test.revs)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d loadDiffRevs err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if test.werr {
+			continue
+		}
+		if !reflect.DeepEqual(gold.Deps, test.wold.Deps) {
+			t.Errorf("%d old Deps = %v want %v", pos, gold.Deps, test.wold.Deps)
+		}
+		if !reflect.DeepEqual(gnew.Deps, test.wnew.Deps) {
+			t.Errorf("%d new Deps = %v want %v", pos, gnew.Deps, test.wnew.Deps)
+		}
+	}
+}
+
+func TestAddLogs(t *testing.T) {
+	start := []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D"), nil},
+				{"+git", "D1", nil},
+				{"main.go", pkg("D") + "\n// 2", nil},
+				{"+git", "D2", nil},
+				{"main.go", pkg("D") + "\n// 3", nil},
+				{"+git", "D3", nil},
+			},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", start}, "")
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	rev := func(tag string) string {
+		return strings.TrimSpace(run(t, filepath.Join(src, "D"), "git", "rev-parse", tag))
+	}
+
+	changes := []depChange{
+		{
+			ImportPath: "D",
+			Old:        depVersion{Rev: rev("D1")},
+			New:        depVersion{Rev: rev("D3")},
+		},
+	}
+	addLogs(changes)
+	want := run(t, filepath.Join(src, "D"), "git", "log", "--oneline", "-2", "D3")
+	if changes[0].Log != want {
+		t.Errorf("Log = %q want %q", changes[0].Log, want)
+	}
+	if n := strings.Count(want, "\n"); n != 2 {
+		t.Errorf("want has %d lines, expected 2", n)
+	}
+}
+
 // diffsEqual asserts that two slices are equivalent.
 func diffsEqual(a, b []string) bool {
 	if len(a) != len(b) {
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// allowDirty lets save and update copy dependencies with
+// uncommitted changes in their working trees.
+var allowDirty bool
+
+// checkDirty returns the hash of the uncommitted changes in the
+// working tree in dir, relative to revision rev. Changes are an
+// error unless -allow-dirty is given.
+func checkDirty(v *VCS, dir, rev string) (string, error) {
+	h, err := v.dirtyHash(dir, rev)
+	if err != nil {
+		return "", err
+	}
+	if h == "" {
+		return "", nil
+	}
+	if !allowDirty {
+		return "", fmt.Errorf("dirty working tree (please commit changes, or use -allow-dirty): %s", dir)
+	}
+	log.Printf("WARNING: copying uncommitted changes in %s; they are not in revision %s", dir, rev)
+	return h, nil
+}
+
+// warnDirty logs a warning for each of deps that was saved
+// with uncommitted changes, since its revision does not
+// reproduce the copied source.
+func warnDirty(deps []Dependency) {
+	for _, dep := range deps {
+		if dep.Dirty != "" {
+			log.Printf("WARNING: %s was saved with uncommitted changes; "+
+				"revision %s does not have the copied source", dep.ImportPath, dep.Rev)
+		}
+	}
+}
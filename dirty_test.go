@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveDirty(t *testing.T) {
+	var cases = []struct {
+		allow bool
+		want  []*node
+		werr  bool
+	}{
+		{ // uncommitted changes fail by default
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", "(absent)", nil},
+			},
+			werr: true,
+		},
+		{
+			allow: true,
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+			},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	defer func() { allowDirty = false }()
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", []*node{
+			{
+				"D",
+				"",
+				[]*node{
+					{"main.go", pkg("D") + decl("D1"), nil},
+					{"+git", "D1", nil},
+				},
+			},
+			{
+				"C",
+				"",
+				[]*node{
+					{"main.go", pkg("main", "D"), nil},
+					{"+git", "", nil},
+				},
+			},
+		}}, "")
+		err = writeFile(filepath.Join(src, "D", "main.go"), pkg("D")+decl("D2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		allowDirty = test.allow
+		log.SetOutput(ioutil.Discard)
+		err = save(nil)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d save err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if err == nil {
+			g, err := loadDefaultGodepsFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(g.Deps) != 1 || g.Deps[0].Dirty == "" {
+				t.Errorf("%d saved deps = %+v want D with Dirty", pos, g.Deps)
+			}
+			// The copy matches the working tree it was saved from.
+			drifts, err := verify(g.Deps, relativeVendorTarget(false))
+			if err != nil || len(drifts) > 0 {
+				t.Errorf("%d verify = %v, %v want no drift", pos, drifts, err)
+			}
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+	}
+}
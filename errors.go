@@ -7,4 +7,11 @@ var (
 	errorLoadingPackages     = errors.New("error loading packages")
 	errorCopyingSourceCode   = errors.New("error copying source code")
 	errorNoPackagesUpdatable = errors.New("no packages can be updated")
+	errorHashMismatch        = errors.New("copied source does not match saved hash")
+	errorNoPackagesRemovable = errors.New("no packages can be removed")
+	errorPackagesStillUsed   = errors.New("packages are still imported")
+	errorNoWorkspace         = errors.New("no Godeps/_workspace/src to migrate")
+	errorVendorConflict      = errors.New("vendor directory already has copied packages")
+	errorCheckingUpstream    = errors.New("error checking upstream repositories")
+	errorRestoringDeps       = errors.New("error restoring dependencies")
 )
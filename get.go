@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 )
 
 var cmdGet = &Command{
@@ -16,6 +17,13 @@ them with the dependencies specified in their Godeps files.
 If any of the packages do not have Godeps files, those are installed
 as if by go get.
 
+If GODEP_CACHE is set, the repositories of the named packages are
+cloned from the repository cache, if possible. See 'godep help cache'.
+Named packages matching a mirror in the godep configuration file are
+downloaded from the mirror. See 'godep help restore'. Their own
+dependencies are downloaded by go get, which does not use the cache
+or the mirrors.
+
 If -verbose is given, verbose output is enabled.
 
 For more about specifying packages, see 'go help packages'.
@@ -32,6 +40,8 @@ func runGet(cmd *Command, args []string) {
 		args = []string{"."}
 	}
 
+	downloadMissing(args)
+
 	cmdArgs := []interface{}{"get", "-d"}
 	if verbose {
 		cmdArgs = append(cmdArgs, "-v")
@@ -69,6 +79,46 @@ func runGet(cmd *Command, args []string) {
 	}
 }
 
+// downloadMissing downloads the repositories of the named
+// packages that are missing from GOPATH, if they match a mirror
+// or the cache is in use, so that go get does not download them
+// from elsewhere. Other errors are left for go get to report.
+func downloadMissing(args []string) {
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(c.Mirrors) == 0 && cacheRoot() == "" {
+		return
+	}
+	ps, err := LoadPackages(args...)
+	if err != nil {
+		return
+	}
+	for _, pkg := range ps {
+		if pkg.Dir != "" || pkg.Standard {
+			continue
+		}
+		if c.mirror(pkg.ImportPath) == nil && cacheRoot() == "" {
+			continue
+		}
+		rr, err := repoRootForImportPath(pkg.ImportPath)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(firstGOPATH(), "src", filepath.FromSlash(rr.Root))
+		if _, err := os.Stat(dir); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+			continue
+		}
+		if err := createRepo(rr.VCS, rr.Repo, dir); err != nil {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
 // command is like exec.Command, but the returned
 // Cmd inherits stderr from the current process, and
 // elements of args may be either string or []string.
@@ -10,7 +10,7 @@ import (
 )
 
 var cmdGo = &Command{
-	Usage: "go command [arguments]",
+	Usage: "go [-verify] command [arguments]",
 	Short: "run the go tool with saved dependencies",
 	Long: `
 Go runs the go tool with a modified GOPATH giving access to
@@ -19,10 +19,24 @@ dependencies saved in Godeps.
 Any go tool command can run this way, but "godep go get"
 is unnecessary and has been disabled. Instead, use
 "godep go install".
+
+If -verify is given, the copied source of each dependency is
+checked against the hash saved in Godeps before running the go
+tool. Copied source with rewritten import paths or patches can't be
+checked.
+
+A warning is printed for each dependency saved with uncommitted
+changes, since its saved revision does not reproduce its source.
 `,
 	Run: runGo,
 }
 
+var goVerify bool
+
+func init() {
+	cmdGo.Flag.BoolVar(&goVerify, "verify", false, "check hashes of copied source")
+}
+
 // Find the godep GOPATH for this file tree and run the go tool.
 func runGo(cmd *Command, args []string) {
 	gopath := prepareGopath()
@@ -35,12 +49,24 @@ func runGo(cmd *Command, args []string) {
 		fmt.Fprintln(os.Stderr, "Run 'godep help go' for usage.")
 		os.Exit(2)
 	}
+	dir, _ := findGodeps()
+	g, err := loadGodepsFile(filepath.Join(dir, godepsFile))
+	if err != nil && goVerify {
+		log.Fatalln(err)
+	}
+	warnDirty(g.Deps)
+	if goVerify {
+		err = checkHashes(filepath.Join(dir, relativeVendorTarget(VendorExperiment)), g.Deps)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
 	c := exec.Command("go", args...)
 	c.Env = append(envNoGopath(), "GOPATH="+gopath)
 	c.Stdin = os.Stdin
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
-	err := c.Run()
+	err = c.Run()
 	if err != nil {
 		log.Fatalln("go", err)
 	}
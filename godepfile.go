@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -22,6 +23,8 @@ type Godeps struct {
 	Packages   []string `json:",omitempty"` // Arguments to save, if any.
 	Deps       []Dependency
 	isOldFile  bool
+	prev       []Dependency // previous Deps, for their LFS policies
+	diffOnly   bool         // fill leaves LFS pointer files alone, as for diff
 }
 
 func createGodepsFile() (*os.File, error) {
@@ -39,6 +42,18 @@ func loadGodepsFile(path string) (Godeps, error) {
 	return g, err
 }
 
+// loadGodepsRev loads the Godeps file in dir as of revision rev
+// of the repository containing dir.
+func loadGodepsRev(v *VCS, dir, rev string) (Godeps, error) {
+	var g Godeps
+	b, err := v.show(dir, godepsFile, rev)
+	if err != nil {
+		return g, fmt.Errorf("cannot load %s at revision %s: %v", godepsFile, rev, err)
+	}
+	err = json.Unmarshal(b, &g)
+	return g, err
+}
+
 func loadDefaultGodepsFile() (Godeps, error) {
 	var err error
 	g, err1 := loadGodepsFile(godepsFile)
@@ -108,37 +123,96 @@ func (g *Godeps) fill(pkgs []*Package, destImportPath string) error {
 			continue
 		}
 		seen = append(seen, pkg.ImportPath)
+		if err := checkWorkspaceCopy(pkg.Dir); err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			continue
+		}
 		vcs, reporoot, err := VCSFromDir(pkg.Dir, filepath.Join(pkg.Root, "src"))
+		if err != nil {
+			a, aerr := findArchive(pkg.Dir, filepath.Join(pkg.Root, "src"))
+			if aerr != nil {
+				log.Println(err)
+				err1 = errorLoadingDeps
+				continue
+			}
+			dep := Dependency{
+				ImportPath: pkg.ImportPath,
+				Archive:    a,
+				dir:        pkg.Dir,
+				ws:         pkg.Root,
+				root:       a.Root,
+			}
+			dep.Hash, err = hashSrc(dep)
+			if err != nil {
+				log.Println(err)
+				err1 = errorLoadingDeps
+				continue
+			}
+			g.Deps = append(g.Deps, dep)
+			continue
+		}
+		id, err := vcs.identify(pkg.Dir)
 		if err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
-		id, err := vcs.identify(pkg.Dir)
+		dirty, err := checkDirty(vcs, pkg.Dir, id)
 		if err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
-		if vcs.isDirty(pkg.Dir, id) {
-			log.Println("dirty working tree (please commit changes):", pkg.Dir)
+		subs, err := vcs.submodules(pkg.Dir)
+		if err != nil {
+			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
 		comment := vcs.describe(pkg.Dir, id)
-		g.Deps = append(g.Deps, Dependency{
+		dep := Dependency{
 			ImportPath: pkg.ImportPath,
 			Rev:        id,
 			Comment:    comment,
+			Submodules: subs,
+			LFS:        g.lfsPolicy(pkg.ImportPath),
+			Dirty:      dirty,
 			dir:        pkg.Dir,
 			ws:         pkg.Root,
 			root:       filepath.ToSlash(reporoot),
 			vcs:        vcs,
-		})
+		}
+		if !g.diffOnly {
+			if err := checkLFS(dep); err != nil {
+				log.Println(err)
+				err1 = errorLoadingDeps
+				continue
+			}
+		}
+		dep.Repo = vcs.forkURL(pkg.Dir, dep.root)
+		dep.Hash, err = hashSrc(dep)
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			continue
+		}
+		g.Deps = append(g.Deps, dep)
 	}
 	return err1
 }
 
+// lfsPolicy returns the LFS policy of the previous dependency
+// that is importPath or contains it.
+func (g *Godeps) lfsPolicy(importPath string) string {
+	for _, dep := range g.prev {
+		if hasPathPrefix(importPath, dep.ImportPath) {
+			return dep.LFS
+		}
+	}
+	return lfsFail
+}
+
 func (g *Godeps) copy() *Godeps {
 	h := *g
 	h.Deps = make([]Dependency, len(g.Deps))
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tools/godep/Godeps/_workspace/src/golang.org/x/tools/go/vcs"
+)
+
+var cmdGraph = &Command{
+	Usage: "graph [-json] [-root] [packages]",
+	Short: "print the import graph of packages and their dependencies",
+	Long: `
+Graph prints the import graph of the named packages and all of
+their dependencies in Graphviz DOT format. Packages in the standard
+library are left out. If no packages are named, the packages saved
+in Godeps are used, or "." if there are none.
+
+Imports made only by test files of the named packages are shown
+as dashed edges.
+
+If -json is given, the graph is printed as a JSON document with
+the following structure:
+
+	type Graph struct {
+		Nodes []string // Import paths.
+		Edges []struct {
+			From string
+			To   string
+			Test bool // Imported only by test files.
+		}
+	}
+
+If -root is given, each package is replaced by the import path
+of the root of the repository containing it. A package copied by
+'godep save -r' is replaced by the root of the repository it was
+copied from.
+
+For more about specifying packages, see 'go help packages'.
+`,
+	Run: runGraph,
+}
+
+var graphJSON, graphRoot bool
+
+func init() {
+	cmdGraph.Flag.BoolVar(&graphJSON, "json", false, "print the graph as JSON")
+	cmdGraph.Flag.BoolVar(&graphRoot, "root", false, "collapse packages to repo roots")
+}
+
+func runGraph(cmd *Command, args []string) {
+	pkgs, err := LoadPackages(savedPackages(args)...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g, err := loadGraph(pkgs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if graphRoot {
+		g = g.collapse(g.roots())
+	}
+	if graphJSON {
+		b, err := json.MarshalIndent(g, "", "\t")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
+		return
+	}
+	g.writeDot(os.Stdout)
+}
+
+// savedPackages returns args, or if it is empty the packages
+// saved in Godeps, or "." if there are none.
+func savedPackages(args []string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalln(err)
+	}
+	if len(g.Packages) > 0 {
+		return g.Packages
+	}
+	return []string{"."}
+}
+
+// A graph is an import graph of non-standard packages.
+type graph struct {
+	Nodes []string
+	Edges []edge
+
+	pkgs map[string]*Package // by import path
+}
+
+// An edge is an import of To by From.
+type edge struct {
+	From string
+	To   string
+	Test bool `json:",omitempty"` // imported only by test files
+}
+
+// loadGraph loads the import graph of pkgs and all their
+// dependencies, including the dependencies of their test files.
+// Rewritten import paths are unqualified.
+func loadGraph(pkgs []*Package) (*graph, error) {
+	var err1 error
+	var path, testImports []string
+	var roots []*Package
+	for _, p := range pkgs {
+		if p.Standard {
+			continue
+		}
+		if p.Error.Err != "" {
+			log.Println(p.Error.Err)
+			err1 = errorLoadingPackages
+			continue
+		}
+		roots = append(roots, p)
+		path = append(path, p.Deps...)
+		testImports = append(testImports, p.TestImports...)
+		testImports = append(testImports, p.XTestImports...)
+	}
+	ps, err := LoadPackages(testImports...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ps {
+		path = append(path, p.ImportPath)
+		path = append(path, p.Deps...)
+	}
+	sort.Strings(path)
+	path = uniq(path)
+	ps, err = LoadPackages(path...)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &graph{pkgs: make(map[string]*Package)}
+	for _, p := range append(roots, ps...) {
+		if p.Standard {
+			continue
+		}
+		if p.Error.Err != "" {
+			log.Println(p.Error.Err)
+			err1 = errorLoadingDeps
+			continue
+		}
+		g.pkgs[unqualify(p.ImportPath)] = p
+	}
+	edges := make(map[edge]bool)
+	add := func(from, to string, test bool) {
+		from, to = unqualify(from), unqualify(to)
+		if g.pkgs[to] == nil || from == to {
+			return
+		}
+		if test && edges[edge{From: from, To: to}] {
+			return // also a non-test import
+		}
+		delete(edges, edge{From: from, To: to, Test: true})
+		edges[edge{From: from, To: to, Test: test}] = true
+	}
+	for _, p := range roots {
+		for _, imp := range p.Imports {
+			add(p.ImportPath, imp, false)
+		}
+	}
+	for _, p := range roots {
+		for _, imp := range p.TestImports {
+			add(p.ImportPath, imp, true)
+		}
+		for _, imp := range p.XTestImports {
+			add(p.ImportPath, imp, true)
+		}
+	}
+	for _, p := range ps {
+		for _, imp := range p.Imports {
+			add(p.ImportPath, imp, false)
+		}
+	}
+	for name := range g.pkgs {
+		g.Nodes = append(g.Nodes, name)
+	}
+	for e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	g.sort()
+	return g, err1
+}
+
+// roots returns the repo root of each package in g that
+// is in a known version control system. A package copied by
+// save -r is in the project's own repository, so its root is
+// found from its import path instead: from the package in
+// GOPATH if it is there, or from the path alone for well-known
+// code hosting sites.
+func (g *graph) roots() map[string]string {
+	m := make(map[string]string)
+	var copies []string
+	for name, p := range g.pkgs {
+		if p.ImportPath != name {
+			copies = append(copies, name)
+			continue
+		}
+		if root, ok := pkgRoot(p); ok {
+			m[name] = root
+		}
+	}
+	sort.Strings(copies)
+	ps, err := LoadPackages(copies...)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, p := range ps {
+		if p.Error.Err == "" {
+			if root, ok := pkgRoot(p); ok {
+				m[p.ImportPath] = root
+			}
+		}
+	}
+	for _, name := range copies {
+		if _, ok := m[name]; ok {
+			continue
+		}
+		if rr, err := vcs.RepoRootForImportPathStatic(name, "https"); err == nil {
+			m[name] = rr.Root
+		}
+	}
+	return m
+}
+
+// pkgRoot returns the repo root of p, if p is in a known
+// version control system.
+func pkgRoot(p *Package) (string, bool) {
+	_, root, err := VCSFromDir(p.Dir, filepath.Join(p.Root, "src"))
+	if err != nil {
+		if verbose {
+			log.Println(err)
+		}
+		return "", false
+	}
+	return filepath.ToSlash(root), true
+}
+
+// collapse returns a copy of g with each node replaced by the
+// node it maps to in m, if any. Edges within a single node are
+// dropped, and an edge is a test edge only if all the edges it
+// replaces are.
+func (g *graph) collapse(m map[string]string) *graph {
+	rename := func(s string) string {
+		if r, ok := m[s]; ok {
+			return r
+		}
+		return s
+	}
+	c := &graph{pkgs: g.pkgs}
+	seen := make(map[string]bool)
+	for _, n := range g.Nodes {
+		n = rename(n)
+		if !seen[n] {
+			seen[n] = true
+			c.Nodes = append(c.Nodes, n)
+		}
+	}
+	test := make(map[edge]bool)
+	for _, e := range g.Edges {
+		k := edge{From: rename(e.From), To: rename(e.To)}
+		if k.From == k.To {
+			continue
+		}
+		if t, ok := test[k]; ok {
+			test[k] = t && e.Test
+		} else {
+			test[k] = e.Test
+		}
+	}
+	for k, t := range test {
+		k.Test = t
+		c.Edges = append(c.Edges, k)
+	}
+	c.sort()
+	return c
+}
+
+func (g *graph) sort() {
+	sort.Strings(g.Nodes)
+	sort.Sort(byEdge(g.Edges))
+}
+
+// writeDot writes g to w in Graphviz DOT format.
+func (g *graph) writeDot(w io.Writer) {
+	fmt.Fprintln(w, "digraph godep {")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(w, "\t%q;\n", n)
+	}
+	for _, e := range g.Edges {
+		attr := ""
+		if e.Test {
+			attr = " [style=dashed]"
+		}
+		fmt.Fprintf(w, "\t%q -> %q%s;\n", e.From, e.To, attr)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+type byEdge []edge
+
+func (a byEdge) Len() int      { return len(a) }
+func (a byEdge) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byEdge) Less(i, j int) bool {
+	if a[i].From != a[j].From {
+		return a[i].From < a[j].From
+	}
+	return a[i].To < a[j].To
+}
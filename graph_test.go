@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadGraph(t *testing.T) {
+	start := []*node{
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D/P", "fmt"), nil},
+				{"main_test.go", pkg("main", "E", "D/P"), nil},
+			},
+		},
+		{
+			"D",
+			"",
+			[]*node{
+				{"P/main.go", pkg("P", "D/Q"), nil},
+				{"Q/main.go", pkg("Q", "T"), nil},
+			},
+		},
+		{"E/main.go", pkg("E", "T"), nil},
+		{"T/main.go", pkg("T"), nil},
+	}
+	want := &graph{
+		Nodes: []string{"C", "D/P", "D/Q", "E", "T"},
+		Edges: []edge{
+			{From: "C", To: "D/P"},
+			{From: "C", To: "E", Test: true},
+			{From: "D/P", To: "D/Q"},
+			{From: "D/Q", To: "T"},
+			{From: "E", To: "T"},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", start}, "")
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	pkgs, err := LoadPackages(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := loadGraph(pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.Nodes, want.Nodes) {
+		t.Errorf("Nodes = %v want %v", g.Nodes, want.Nodes)
+	}
+	if !reflect.DeepEqual(g.Edges, want.Edges) {
+		t.Errorf("Edges = %v want %v", g.Edges, want.Edges)
+	}
+}
+
+func TestGraphCollapse(t *testing.T) {
+	g := &graph{
+		Nodes: []string{"C", "D/P", "D/Q", "E", "T"},
+		Edges: []edge{
+			{From: "C", To: "D/P"},
+			{From: "C", To: "E", Test: true},
+			{From: "D/P", To: "D/Q"},
+			{From: "D/Q", To: "T"},
+			{From: "E", To: "D/Q", Test: true},
+			{From: "E", To: "T"},
+		},
+	}
+	roots := map[string]string{"D/P": "D", "D/Q": "D"}
+	want := &graph{
+		Nodes: []string{"C", "D", "E", "T"},
+		Edges: []edge{
+			{From: "C", To: "D"},
+			{From: "C", To: "E", Test: true},
+			{From: "D", To: "T"},
+			{From: "E", To: "D", Test: true},
+			{From: "E", To: "T"},
+		},
+	}
+	c := g.collapse(roots)
+	if !reflect.DeepEqual(c.Nodes, want.Nodes) {
+		t.Errorf("Nodes = %v want %v", c.Nodes, want.Nodes)
+	}
+	if !reflect.DeepEqual(c.Edges, want.Edges) {
+		t.Errorf("Edges = %v want %v", c.Edges, want.Edges)
+	}
+
+	const dot = `digraph godep {
+	"C";
+	"D";
+	"E";
+	"T";
+	"C" -> "D";
+	"C" -> "E" [style=dashed];
+	"D" -> "T";
+	"E" -> "D" [style=dashed];
+	"E" -> "T";
+}
+`
+	var buf bytes.Buffer
+	c.writeDot(&buf)
+	if buf.String() != dot {
+		t.Errorf("writeDot = %q want %q", buf.String(), dot)
+	}
+}
+
+func TestGraphRootRewritten(t *testing.T) {
+	const ws = "C/Godeps/_workspace/src/"
+	start := []*node{
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", ws+"D/P"), nil},
+				{"Godeps/_workspace/src/D/P/main.go", pkg("P", ws+"D/Q"), nil},
+				{"Godeps/_workspace/src/D/Q/main.go", pkg("Q", ws+"github.com/x/e/sub"), nil},
+				{"Godeps/_workspace/src/github.com/x/e/sub/main.go", pkg("sub"), nil},
+				{"+git", "", nil},
+			},
+		},
+		{
+			"D",
+			"",
+			[]*node{
+				{"P/main.go", pkg("P", "D/Q"), nil},
+				{"Q/main.go", pkg("Q"), nil},
+				{"+git", "D1", nil},
+			},
+		},
+	}
+	want := &graph{
+		Nodes: []string{"C", "D", "github.com/x/e"},
+		Edges: []edge{
+			{From: "C", To: "D"},
+			{From: "D", To: "github.com/x/e"},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{src, "", start}, "")
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	pkgs, err := LoadPackages(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := loadGraph(pkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := g.collapse(g.roots())
+	if !reflect.DeepEqual(c.Nodes, want.Nodes) {
+		t.Errorf("Nodes = %v want %v", c.Nodes, want.Nodes)
+	}
+	if !reflect.DeepEqual(c.Edges, want.Edges) {
+		t.Errorf("Edges = %v want %v", c.Edges, want.Edges)
+	}
+}
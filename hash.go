@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tools/godep/Godeps/_workspace/src/github.com/kr/fs"
+)
+
+var errRewrittenSource = errors.New("copied source has rewritten import paths")
+
+// hashSrc returns the hash of the source files of dep in GOPATH,
+// as they would be copied by save.
+// Test files and testdata directories are never included, so the
+// hash does not depend on save -t.
+func hashSrc(dep Dependency) (string, error) {
+	files := make(map[string]string)
+	srcdir := filepath.Join(dep.ws, "src")
+	vf := dep.vcs.listFiles(dep.dir)
+	w := fs.Walk(dep.dir)
+	for w.Step() {
+		err := copyPkgFile(vf, srcdir, w, func(rel, path string) error {
+			rel, err := filepath.Rel(dep.dir, path)
+			if err != nil { // this should never happen
+				return err
+			}
+			if !isTestFile(rel) {
+				files[filepath.ToSlash(rel)] = path
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return hashFiles(files)
+}
+
+// hashCopy returns the hash of the copied source of dep in srcdir,
+// computed the same way as hashSrc. It returns errRewrittenSource
+// if any copied Go file refers to a rewritten import path, since
+// such files can't match the original source.
+func hashCopy(srcdir string, dep Dependency) (string, error) {
+	files := make(map[string]string)
+	dir := filepath.Join(srcdir, filepath.FromSlash(dep.ImportPath))
+	w := fs.Walk(dir)
+	for w.Step() {
+		if w.Err() != nil {
+			return "", w.Err()
+		}
+		name := w.Stat().Name()
+		if w.Stat().IsDir() {
+			if name[0] == '.' || name[0] == '_' || name == "testdata" {
+				w.SkipDir()
+			}
+			continue
+		}
+		rel, err := filepath.Rel(dir, w.Path())
+		if err != nil { // this should never happen
+			return "", err
+		}
+		if !isTestFile(rel) {
+			files[filepath.ToSlash(rel)] = w.Path()
+		}
+	}
+	for _, path := range files {
+		if strings.HasSuffix(path, ".go") {
+			if ok, _ := hasRewrittenImportStatement(path); ok {
+				return "", errRewrittenSource
+			}
+		}
+	}
+	return hashFiles(files)
+}
+
+// checkHashes checks the copied source in srcdir of each of deps
+// that has a hash. Mismatches are logged.
+func checkHashes(srcdir string, deps []Dependency) error {
+	var err1 error
+	for _, dep := range deps {
+		if dep.Hash == "" {
+			continue
+		}
+		if len(dep.Patches) > 0 {
+			log.Printf("%s: cannot check hash: copied source is patched", dep.ImportPath)
+			continue
+		}
+		h, err := hashCopy(srcdir, dep)
+		if err == errRewrittenSource {
+			log.Printf("%s: cannot check hash: %v", dep.ImportPath, err)
+			continue
+		}
+		if err != nil {
+			log.Println(err)
+			err1 = errorHashMismatch
+			continue
+		}
+		if h != dep.Hash {
+			log.Printf("%s: hash of copied source is %s, want %s", dep.ImportPath, h, dep.Hash)
+			err1 = errorHashMismatch
+		}
+	}
+	return err1
+}
+
+// isTestFile reports whether the slash-separated name is a
+// test file or is inside a testdata directory.
+func isTestFile(name string) bool {
+	return strings.HasSuffix(name, "_test.go") ||
+		name == "testdata" || strings.HasPrefix(name, "testdata/") ||
+		strings.Contains(name, "/testdata/")
+}
+
+// hashFiles returns a hash of the given files, keyed by their
+// slash-separated names. Each file is hashed with the contents
+// copyFile would give it; symbolic links are hashed by target.
+// The result is a hex-encoded SHA-256 sum of one line per file,
+// in name order, holding the file's sum and name.
+func hashFiles(files map[string]string) (string, error) {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		sum, err := hashFile(files[name])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x  %s\n", sum, name)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	h := sha256.New()
+	if link, err := os.Readlink(path); err == nil {
+		io.WriteString(h, link)
+		return h.Sum(nil), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := copyContents(h, f, path); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	var cases = []struct {
+		cwd    string
+		flagT  bool
+		start  []*node
+		tamper []*node // written to the copy after save
+		werr   bool
+	}{
+		{ // unchanged copy
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", "package D // import \"D\"\n", nil},
+						{"main_test.go", pkg("D"), nil},
+						{"testdata/x", "x", nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+		},
+		{ // test files don't affect the hash
+			cwd:   "C",
+			flagT: true,
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"main_test.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			tamper: []*node{
+				{"C/Godeps/_workspace/src/D/main_test.go", pkg("D") + decl("T"), nil},
+			},
+		},
+		{ // modified copy
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			tamper: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("X"), nil},
+			},
+			werr: true,
+		},
+		{ // added file
+			cwd: "C",
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"+git", "", nil},
+					},
+				},
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+			},
+			tamper: []*node{
+				{"C/Godeps/_workspace/src/D/extra.go", pkg("D"), nil},
+			},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		dir := filepath.Join(wd, src, test.cwd)
+		err = os.Chdir(dir)
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		saveR = false
+		saveT = test.flagT
+		err = save(nil)
+		saveT = false
+		if err != nil {
+			t.Fatalf("%d save: %v", pos, err)
+		}
+		g, err := loadDefaultGodepsFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dep := range g.Deps {
+			if dep.Hash == "" {
+				t.Errorf("%d %s: no hash saved", pos, dep.ImportPath)
+			}
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		if test.tamper != nil {
+			makeTree(t, &node{src, "", test.tamper}, "")
+		}
+		log.SetOutput(ioutil.Discard)
+		err = checkHashes(filepath.Join(dir, "Godeps", "_workspace", "src"), g.Deps)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d checkHashes err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+	}
+}
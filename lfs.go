@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LFS policies for dependencies with Git LFS pointer files.
+const (
+	lfsFail  = ""      // report the pointer files as errors
+	lfsFetch = "fetch" // fetch the content of the pointer files
+	lfsKeep  = "keep"  // copy the pointer files as they are
+)
+
+// lfsPointerPrefix starts every Git LFS pointer file.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1\n"
+
+// isLFSPointer reports whether the file at path is a Git LFS
+// pointer file, rather than the content it points to.
+func isLFSPointer(path string) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() > 1024 {
+		return false
+	}
+	b, err := ioutil.ReadFile(path)
+	return err == nil && bytes.HasPrefix(b, []byte(lfsPointerPrefix))
+}
+
+// lfsPointers returns the files of dep, as save would copy them,
+// that are Git LFS pointer files.
+func lfsPointers(dep Dependency) []string {
+	var a []string
+	walkSrc(dep, make(map[string]bool), func(rel, path string) error {
+		if isLFSPointer(path) {
+			a = append(a, path)
+		}
+		return nil
+	})
+	return a
+}
+
+// checkLFS looks for Git LFS pointer files in dep, and deals
+// with them as its LFS policy says.
+func checkLFS(dep Dependency) error {
+	ptrs := lfsPointers(dep)
+	if len(ptrs) == 0 {
+		return nil
+	}
+	switch dep.LFS {
+	case lfsKeep:
+		return nil
+	case lfsFetch:
+		root, err := dep.vcs.root(dep.dir)
+		if err != nil {
+			return err
+		}
+		var files []string
+		for _, path := range ptrs {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		err = dep.vcs.run(root, dep.vcs.LFSFetchCmd, "files", strings.Join(files, ","))
+		if err != nil {
+			return fmt.Errorf("%s: cannot fetch Git LFS content: %v", dep.ImportPath, err)
+		}
+		ptrs = lfsPointers(dep)
+		if len(ptrs) == 0 {
+			return nil
+		}
+	case lfsFail:
+	default:
+		return fmt.Errorf("%s: unknown LFS policy %q", dep.ImportPath, dep.LFS)
+	}
+	return fmt.Errorf("%s: Git LFS pointer files instead of their content "+
+		"(run 'git lfs pull', or set LFS in Godeps.json to \"fetch\" or \"keep\"):\n\t%s",
+		dep.ImportPath, strings.Join(ptrs, "\n\t"))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const lfsPointer = lfsPointerPrefix +
+	"oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\n" +
+	"size 12345\n"
+
+func TestIsLFSPointer(t *testing.T) {
+	var cases = []struct {
+		body string
+		want bool
+	}{
+		{lfsPointer, true},
+		{"package D\n", false},
+		{"", false},
+		{lfsPointer + strings.Repeat("x", 1024), false}, // too big to be a pointer
+	}
+	const scratch = "godeptest"
+	defer os.RemoveAll(scratch)
+	for pos, test := range cases {
+		err := os.RemoveAll(scratch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(scratch, "f")
+		err = writeFile(name, test.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g := isLFSPointer(name); g != test.want {
+			t.Errorf("%d isLFSPointer = %v want %v", pos, g, test.want)
+		}
+	}
+}
+
+func TestSaveLFS(t *testing.T) {
+	withPolicy := func(policy string) *Godeps {
+		g := godeps("C", "D", "D1")
+		g.Deps[0].LFS = policy
+		return g
+	}
+	var cases = []struct {
+		godeps *Godeps
+		want   []*node
+		werr   bool
+	}{
+		{ // pointer files fail by default
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", "(absent)", nil},
+			},
+			werr: true,
+		},
+		{ // policy keep copies them
+			godeps: withPolicy(lfsKeep),
+		},
+		{
+			godeps: withPolicy("other"),
+			werr:   true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		c := []*node{
+			{"main.go", pkg("main", "D"), nil},
+			{"+git", "", nil},
+		}
+		if test.godeps != nil {
+			c = append(c, &node{"Godeps/Godeps.json", test.godeps, nil})
+		}
+		makeTree(t, &node{src, "", []*node{
+			{
+				"D",
+				"",
+				[]*node{
+					{"main.go", pkg("D") + decl("D1"), nil},
+					{"data.bin", lfsPointer, nil},
+					{"+git", "D1", nil},
+				},
+			},
+			{"C", "", c},
+		}}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = save(nil)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d save err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if err == nil {
+			g, err := loadDefaultGodepsFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(g.Deps) != 1 || g.Deps[0].LFS != test.godeps.Deps[0].LFS {
+				t.Errorf("%d saved deps = %+v want LFS %q", pos, g.Deps, test.godeps.Deps[0].LFS)
+			}
+			gold, gnew, err := loadDiffGOPATH()
+			if err != nil {
+				t.Errorf("%d diff err = %v", pos, err)
+			} else if diff, _ := diffStr(&gold, &gnew); diff != "" {
+				t.Errorf("%d diff = %q want none", pos, diff)
+			}
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		if test.want != nil {
+			checkTree(t, pos, &node{src, "", test.want})
+		}
+	}
+}
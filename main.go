@@ -61,7 +61,15 @@ var commands = []*Command{
 	cmdPath,
 	cmdRestore,
 	cmdUpdate,
+	cmdRemove,
+	cmdUnrewrite,
+	cmdMigrateVendor,
 	cmdDiff,
+	cmdVerify,
+	cmdOutdated,
+	cmdGraph,
+	cmdWhy,
+	cmdCache,
 	cmdVersion,
 }
 
@@ -80,6 +88,10 @@ func main() {
 		return
 	}
 
+	if err := loadVCSConfig(); err != nil {
+		log.Fatalln(err)
+	}
+
 	for _, cmd := range commands {
 		if cmd.Name() == args[0] {
 			cmd.Flag.Usage = func() { cmd.UsageExit() }
@@ -103,7 +115,7 @@ Usage:
 
 The commands are:
 {{range .}}
-    {{.Name | printf "%-8s"}} {{.Short}}{{end}}
+    {{.Name | printf "%-14s"}} {{.Short}}{{end}}
 
 Use "godep help [command]" for more information about a command.
 `
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tools/godep/Godeps/_workspace/src/github.com/kr/fs"
+)
+
+var cmdMigrateVendor = &Command{
+	Usage: "migrate-vendor",
+	Short: "move copied source code from Godeps/_workspace to vendor/",
+	Long: `
+Migrate-vendor moves the copied source code of all dependencies from
+Godeps/_workspace/src to vendor/, for use with the Go 1.5 vendor
+experiment. It must be run in the directory containing Godeps.
+
+Import statements rewritten by 'godep save -r' are first restored to
+their original form, in the packages saved in Godeps (or ".", if
+there are none) and in the copied source code. Then the copied
+packages are moved, and Godeps/_workspace, including its .gitignore
+file, is removed. Nothing in GOPATH is changed.
+
+If vendor/ already contains any of the copied packages, or any of them
+cannot be moved, or an import statement cannot be restored, nothing
+is changed.
+
+After migrating, set GO15VENDOREXPERIMENT=1 to use the vendor directory.
+`,
+	Run: runMigrateVendor,
+}
+
+func runMigrateVendor(cmd *Command, args []string) {
+	if len(args) != 0 {
+		cmd.UsageExit()
+	}
+	err := migrateVendor()
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func migrateVendor() error {
+	// Both the workspace and any rewritten imports use the
+	// workspace layout, whatever the vendor experiment setting.
+	defer func(s string) { sep = s }(sep)
+	sep = defaultSep(false)
+
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return err
+	}
+	srcdir := relativeVendorTarget(false)
+	vendordir := relativeVendorTarget(true)
+	fis, err := ioutil.ReadDir(srcdir)
+	if os.IsNotExist(err) {
+		return errorNoWorkspace
+	}
+	if err != nil {
+		return err
+	}
+	var err1 error
+	for _, fi := range fis {
+		if _, err := os.Lstat(filepath.Join(vendordir, fi.Name())); err == nil {
+			log.Println("already in vendor:", fi.Name())
+			err1 = errorVendorConflict
+		}
+	}
+	if err1 != nil {
+		return err1
+	}
+	pkgs, err := LoadPackages(savedPackages(g.Packages)...)
+	if err != nil {
+		return err
+	}
+
+	// Keep the files the rewrite may change, to undo it on error.
+	files := pkgFiles(pkgs)
+	backup, err := readRewritten(append(files, srcdir))
+	if err != nil {
+		return err
+	}
+	err = moveEntries(srcdir, vendordir, fis)
+	if err != nil {
+		return err
+	}
+	err = unrewriteMigrated(files, vendordir)
+	if err != nil {
+		if err1 := moveEntries(vendordir, srcdir, fis); err1 != nil {
+			log.Println(err1)
+		}
+		os.Remove(vendordir) // only if empty; ignore error
+		for name, f := range backup {
+			if err1 := ioutil.WriteFile(name, f.data, f.mode); err1 != nil {
+				log.Println(err1)
+			}
+		}
+		return err
+	}
+	// This also removes the .gitignore written by writeVCSIgnore.
+	err = os.RemoveAll(filepath.Join("Godeps", "_workspace"))
+	if err != nil {
+		return err
+	}
+	_, err = g.save()
+	return err
+}
+
+// unrewriteMigrated restores the import statements rewritten
+// by save -r in files and in the tree vendordir.
+func unrewriteMigrated(files []string, vendordir string) error {
+	for _, path := range files {
+		err := rewriteTree(path, "", nil)
+		if err != nil {
+			return err
+		}
+	}
+	return rewriteTree(vendordir, "", nil)
+}
+
+// A savedFile is the contents and mode of a file.
+type savedFile struct {
+	data []byte
+	mode os.FileMode
+}
+
+// readRewritten reads the go files in the trees at paths, as
+// visited by rewriteTree, that may have rewritten imports.
+func readRewritten(paths []string) (map[string]savedFile, error) {
+	m := make(map[string]savedFile)
+	for _, path := range paths {
+		w := fs.Walk(path)
+		for w.Step() {
+			if w.Err() != nil {
+				continue
+			}
+			if w.Stat().IsDir() {
+				if w.Stat().Name() == "testdata" {
+					w.SkipDir()
+				}
+				continue
+			}
+			if !strings.HasSuffix(w.Path(), ".go") {
+				continue
+			}
+			b, err := ioutil.ReadFile(w.Path())
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Contains(b, []byte(sep)) {
+				m[w.Path()] = savedFile{b, w.Stat().Mode()}
+			}
+		}
+	}
+	return m, nil
+}
+
+// moveEntries renames each of fis in dir src to the same name in
+// dir dst. If any rename fails, the entries already moved are
+// moved back.
+func moveEntries(src, dst string, fis []os.FileInfo) error {
+	err := os.MkdirAll(dst, 0777)
+	if err != nil {
+		return err
+	}
+	for i, fi := range fis {
+		err = os.Rename(filepath.Join(src, fi.Name()), filepath.Join(dst, fi.Name()))
+		if err != nil {
+			for _, fi := range fis[:i] {
+				err1 := os.Rename(filepath.Join(dst, fi.Name()), filepath.Join(src, fi.Name()))
+				if err1 != nil {
+					log.Println(err1)
+				}
+			}
+			os.Remove(dst) // only if empty; ignore error
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateVendor(t *testing.T) {
+	var cases = []struct {
+		start []*node
+		want  []*node
+		werr  bool
+	}{
+		{ // rewritten imports are restored and the workspace removed
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "T", "T1"), nil},
+						{"Godeps/_workspace/.gitignore", "/pkg\n/bin\n", nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+						{"Godeps/_workspace/src/T/main.go", pkg("T"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/vendor/D/main.go", pkg("D", "T"), nil},
+				{"C/vendor/T/main.go", pkg("T"), nil},
+				{"C/Godeps/_workspace", "(absent)", nil},
+			},
+		},
+		{ // conflict with existing vendor directory
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "T", "T1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+						{"Godeps/_workspace/src/T/main.go", pkg("T"), nil},
+						{"vendor/T/main.go", pkg("T"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+				{"C/Godeps/_workspace/src/T/main.go", pkg("T"), nil},
+				{"C/vendor/D", "(absent)", nil},
+			},
+			werr: true,
+		},
+		{ // import statement cannot be restored, everything is rolled back
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "T", "T1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+						{"Godeps/_workspace/src/T/main.go", pkg("T"), nil},
+						{"Godeps/_workspace/src/T/bad.go", "package T\n\nfunc {\n", nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+				{"C/Godeps/_workspace/src/T/bad.go", "package T\n\nfunc {\n", nil},
+				{"C/vendor", "(absent)", nil},
+			},
+			werr: true,
+		},
+		{ // nothing to migrate
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/vendor", "(absent)", nil},
+			},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = migrateVendor()
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d migrateVendor err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var cmdOutdated = &Command{
+	Usage: "outdated [-json]",
+	Short: "list dependencies with newer upstream revisions",
+	Long: `
+Outdated lists the repositories of dependencies in Godeps/Godeps.json
+whose saved revision is not the latest commit of the default branch
+upstream. For each one it prints the saved revision, the latest tag
+that looks like a version number (such as v1.2.3), if any, and the
+latest commit.
+
+The upstream repository is the default remote of the dependency's
+repository in GOPATH. New commits are fetched into that repository
+without changing its checkout, or, if the repository cache is in use
+(see godep help cache), into the mirror in the cache. Either way the
+working tree in GOPATH is left unchanged.
+
+If -json is given, the list is printed as a JSON array of objects
+with the following structure:
+
+	type Outdated struct {
+		Root      string // Import path of the repository root.
+		Rev       string // Saved revision.
+		Comment   string // Saved description, if present.
+		LatestTag string // Latest version tag, if present.
+		LatestRev string // Latest commit of the default branch.
+	}
+`,
+	Run: runOutdated,
+}
+
+var outdatedJSON bool
+
+func init() {
+	cmdOutdated.Flag.BoolVar(&outdatedJSON, "json", false, "print the list as JSON")
+}
+
+func runOutdated(cmd *Command, args []string) {
+	if len(args) != 0 {
+		cmd.UsageExit()
+	}
+	a, err := outdated()
+	if outdatedJSON {
+		if a == nil {
+			a = make([]outdatedRepo, 0) // produce json [], not null
+		}
+		b, err := json.MarshalIndent(a, "", "\t")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		os.Stdout.Write(append(b, '\n'))
+	} else {
+		for _, o := range a {
+			fmt.Println(o)
+		}
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// An outdatedRepo is a dependency repository whose saved
+// revision is behind its upstream repository.
+type outdatedRepo struct {
+	Root      string
+	Rev       string
+	Comment   string `json:",omitempty"`
+	LatestTag string `json:",omitempty"`
+	LatestRev string
+}
+
+func (o outdatedRepo) String() string {
+	s := o.Root + " " + o.Rev
+	if o.Comment != "" {
+		s += " (" + o.Comment + ")"
+	}
+	if o.LatestTag != "" {
+		s += ", latest tag " + o.LatestTag
+	}
+	return s + ", latest commit " + o.LatestRev
+}
+
+// outdated checks the upstream repository of each repo root in
+// the manifest, and returns those that have newer commits.
+// Errors are logged, and the remaining repositories checked.
+func outdated() ([]outdatedRepo, error) {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return nil, err
+	}
+	err1 := loadDeps(g.Deps)
+	var a []outdatedRepo
+	seen := make(map[string]bool)
+	for _, dep := range g.Deps {
+		if dep.vcs == nil || seen[dep.root] {
+			continue
+		}
+		seen[dep.root] = true
+		o, err := checkUpstream(dep)
+		if err != nil {
+			log.Println(err)
+			err1 = errorCheckingUpstream
+			continue
+		}
+		if o.LatestRev != o.Rev {
+			a = append(a, o)
+		}
+	}
+	return a, err1
+}
+
+// checkUpstream fetches new commits from the upstream repository
+// of dep and finds its latest tag and commit. It fetches into the
+// mirror in the cache if the cache is in use, and otherwise into
+// dep's repository in GOPATH without changing its checkout. If the
+// version control system cannot do that, it clones the upstream
+// repository into a temporary directory.
+func checkUpstream(dep Dependency) (outdatedRepo, error) {
+	o := outdatedRepo{Root: dep.root, Rev: dep.Rev, Comment: dep.Comment}
+	v := dep.vcs
+	repo := filepath.Join(dep.ws, "src", filepath.FromSlash(dep.root))
+	remote, err := v.remote(repo)
+	if err != nil {
+		return o, fmt.Errorf("cannot find upstream of %s: %v", dep.root, err)
+	}
+	if v.MirrorCmd != "" && cacheRoot() != "" {
+		mirror, err := updateMirror(v, remote)
+		if err == nil {
+			return latestUpstream(o, v, mirror, v.head)
+		}
+		log.Println(err)
+	}
+	if v.UpstreamHeadCmd != "" {
+		if v.UpstreamFetchCmd != "" {
+			err = v.run(repo, v.UpstreamFetchCmd)
+			if err != nil {
+				return o, fmt.Errorf("cannot fetch %s: %v", dep.root, err)
+			}
+		}
+		return latestUpstream(o, v, repo, v.upstreamHead)
+	}
+	tmp, err := ioutil.TempDir("", "godep-outdated")
+	if err != nil {
+		return o, err
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "repo")
+	err = v.vcs.Create(dir, remote)
+	if err != nil {
+		return o, fmt.Errorf("cannot clone %s: %v", remote, err)
+	}
+	return latestUpstream(o, v, dir, v.head)
+}
+
+// latestUpstream sets the latest tag and commit of o from the
+// repository in dir, using head to find the commit.
+func latestUpstream(o outdatedRepo, v *VCS, dir string, head func(string) (string, error)) (outdatedRepo, error) {
+	tags, err := v.vcs.Tags(dir)
+	if err != nil {
+		return o, err
+	}
+	o.LatestTag = latestVersion(tags)
+	o.LatestRev, err = head(dir)
+	return o, err
+}
+
+var versionTag = regexp.MustCompile(`^v?[0-9]`)
+
+// latestVersion returns the highest of the tags that look
+// like version numbers, or "" if there are none.
+func latestVersion(tags []string) string {
+	var a []string
+	for _, t := range tags {
+		if versionTag.MatchString(t) {
+			a = append(a, t)
+		}
+	}
+	if len(a) == 0 {
+		return ""
+	}
+	sort.Sort(byVersion(a))
+	return a[len(a)-1]
+}
+
+// byVersion sorts tags so that runs of digits compare
+// numerically, as in v1.9 < v1.10.
+type byVersion []string
+
+func (a byVersion) Len() int      { return len(a) }
+func (a byVersion) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byVersion) Less(i, j int) bool {
+	x, y := versionParts(a[i]), versionParts(a[j])
+	for k := 0; k < len(x) && k < len(y); k++ {
+		if x[k] == y[k] {
+			continue
+		}
+		nx, errx := strconv.Atoi(x[k])
+		ny, erry := strconv.Atoi(y[k])
+		if errx == nil && erry == nil {
+			return nx < ny
+		}
+		return x[k] < y[k]
+	}
+	return len(x) < len(y)
+}
+
+var versionPart = regexp.MustCompile(`[0-9]+|[^0-9]+`)
+
+// versionParts splits s into runs of digits and non-digits.
+func versionParts(s string) []string {
+	return versionPart.FindAllString(s, -1)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutdated(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := filepath.Join(wd, gopath, "upstream")
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{upstream, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D1"), nil},
+				{"+git", "v1.9", nil},
+			},
+		},
+		{
+			"E",
+			"",
+			[]*node{
+				{"main.go", pkg("E") + decl("E1"), nil},
+				{"+git", "E1", nil},
+			},
+		},
+	}}, "")
+	err = os.MkdirAll(src, 0770)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"D", "E"} {
+		run(t, src, "git", "clone", "-q", "file://"+filepath.Join(upstream, name), name)
+	}
+	// as left by godep restore
+	run(t, filepath.Join(src, "D"), "git", "checkout", "-q", "--detach")
+	// a local branch is not the upstream default branch
+	run(t, filepath.Join(src, "E"), "git", "checkout", "-q", "-b", "dev")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"E",
+			"",
+			[]*node{
+				{"main.go", pkg("E") + decl("E2"), nil},
+				{"+git", "", nil},
+			},
+		},
+	}}, "")
+	makeTree(t, &node{upstream, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D") + decl("D2"), nil},
+				{"+git", "v1.10", nil},
+				{"main.go", pkg("D") + decl("D3"), nil},
+				{"+git", "", nil},
+			},
+		},
+	}}, "")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "D", "E"), nil},
+				{"Godeps/Godeps.json", godeps("C", "D", "v1.9", "E", "E1"), nil},
+				{"+git", "", nil},
+			},
+		},
+	}}, "")
+	rev := func(dir, tag string) string {
+		return strings.TrimSpace(run(t, dir, "git", "rev-parse", tag))
+	}
+	want := []outdatedRepo{
+		{
+			Root:      "D",
+			Rev:       rev(filepath.Join(src, "D"), "v1.9"),
+			Comment:   "v1.9",
+			LatestTag: "v1.10",
+			LatestRev: rev(filepath.Join(upstream, "D"), "HEAD"),
+		},
+	}
+
+	err = os.Chdir(filepath.Join(wd, src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Setenv("GODEP_CACHE", os.Getenv("GODEP_CACHE"))
+	saved := rev(filepath.Join(wd, src, "D"), "HEAD")
+	for _, cache := range []string{filepath.Join(wd, gopath, "cache"), ""} {
+		err = os.Setenv("GODEP_CACHE", cache)
+		if err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		a, err := outdated()
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(a, want) {
+			t.Errorf("cache %q: outdated = %+v want %+v", cache, a, want)
+		}
+		if head := rev(filepath.Join(wd, src, "D"), "HEAD"); head != saved {
+			t.Errorf("cache %q: D at %s want %s", cache, head, saved)
+		}
+		if _, err := os.Stat(cacheDir(vcsGit, "file://"+filepath.Join(upstream, "D"))); cache != "" && err != nil {
+			t.Errorf("cache %q: no mirror of D: %v", cache, err)
+		}
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	var cases = []struct {
+		tags []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"master", "HEAD"}, ""},
+		{[]string{"v1.9", "v1.10", "v1.2", "master"}, "v1.10"},
+		{[]string{"1.0", "1.0.1", "0.9"}, "1.0.1"},
+	}
+	for _, test := range cases {
+		if g := latestVersion(test.tags); g != test.want {
+			t.Errorf("latestVersion(%v) = %q want %q", test.tags, g, test.want)
+		}
+	}
+}
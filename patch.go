@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// patchesDir holds the patches for the copied source of each
+// dependency, in a subdirectory named by its import path.
+var patchesDir = filepath.Join("Godeps", "patches")
+
+// A Patch is a change applied to the copied source of a dependency.
+type Patch struct {
+	Name string // File name in Godeps/patches/<import path>.
+	Hash string // SHA-256 hash of the patch file.
+}
+
+// loadPatches returns the patches in patchesDir for the dependency
+// importPath, in the order they are applied.
+func loadPatches(importPath string) ([]Patch, error) {
+	dir := filepath.Join(patchesDir, filepath.FromSlash(importPath))
+	names, err := filepath.Glob(filepath.Join(dir, "*.patch"))
+	if err != nil {
+		return nil, err
+	}
+	var a []Patch
+	for _, name := range names {
+		h, err := hashPatch(name)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, Patch{Name: filepath.Base(name), Hash: h})
+	}
+	return a, nil
+}
+
+// setPatches sets the patches of each dependency in deps
+// from patchesDir.
+func setPatches(deps []Dependency) error {
+	for i := range deps {
+		var err error
+		deps[i].Patches, err = loadPatches(deps[i].ImportPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashPatch(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// patchSrc applies the patches of each of deps, in order, to its
+// copied source in dir.
+func patchSrc(dir string, deps []Dependency) error {
+	for _, dep := range deps {
+		if err := applyPatches(dir, dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPatches checks that the patches of each of deps apply to
+// its source, on a temporary copy, so nothing is written if one
+// does not.
+func checkPatches(deps []Dependency) error {
+	for _, dep := range deps {
+		if len(dep.Patches) == 0 {
+			continue
+		}
+		tmp, err := patchedCopy(dep)
+		if err != nil {
+			return err
+		}
+		os.RemoveAll(tmp)
+	}
+	return nil
+}
+
+// applyPatches applies the patches of dep to its copied source
+// in dir, after checking that they have not changed. Paths in the
+// patches are relative to the directory of dep, with one leading
+// component to strip, as in the output of git diff.
+func applyPatches(dir string, dep Dependency) error {
+	if len(dep.Patches) == 0 {
+		return nil
+	}
+	pkgdir, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(dep.ImportPath)))
+	if err != nil {
+		return err
+	}
+	for _, p := range dep.Patches {
+		path, err := filepath.Abs(filepath.Join(patchesDir, filepath.FromSlash(dep.ImportPath), p.Name))
+		if err != nil {
+			return err
+		}
+		h, err := hashPatch(path)
+		if err != nil {
+			return err
+		}
+		if h != p.Hash {
+			return fmt.Errorf("%s: patch %s has changed since it was applied (run 'godep update %s')", dep.ImportPath, p.Name, dep.ImportPath)
+		}
+		// Keep git from finding the repository around dir,
+		// so it patches the files there like patch -p1.
+		cmd := exec.Command("git", "apply", path)
+		cmd.Dir = pkgdir
+		cmd.Env = append(os.Environ(), "GIT_CEILING_DIRECTORIES="+filepath.Dir(pkgdir))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: patch %s does not apply to revision %s: %v\n%s", dep.ImportPath, p.Name, dep.Rev, err, out)
+		}
+	}
+	return nil
+}
+
+// patchedCopy copies the source of dep, as save would, into a new
+// temporary directory and applies the patches of dep there. The
+// caller must remove the directory.
+func patchedCopy(dep Dependency) (string, error) {
+	tmp, err := ioutil.TempDir("", "godep-patch")
+	if err != nil {
+		return "", err
+	}
+	if !walkSrc(dep, make(map[string]bool), func(rel, path string) error {
+		return copyFile(filepath.Join(tmp, rel), path)
+	}) {
+		os.RemoveAll(tmp)
+		return "", errorCopyingSourceCode
+	}
+	if err := applyPatches(tmp, dep); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
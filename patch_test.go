@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// xPatch returns a patch changing the value of X in x.go.
+func xPatch(old, new string) string {
+	return "--- a/x.go\n+++ b/x.go\n@@ -1,3 +1,3 @@\n package D\n \n" +
+		"-var X = " + old + "\n+var X = " + new + "\n"
+}
+
+func TestSavePatches(t *testing.T) {
+	var cases = []struct {
+		godeps  *Godeps
+		patches []*node
+		want    []*node
+		werr    bool
+	}{
+		{
+			patches: []*node{
+				{"0001-x.patch", xPatch("1", "2"), nil},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/x.go", "package D\n\nvar X = 2\n", nil},
+			},
+		},
+		{ // applied in order
+			patches: []*node{
+				{"0002-x.patch", xPatch("2", "3"), nil},
+				{"0001-x.patch", xPatch("1", "2"), nil},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/x.go", "package D\n\nvar X = 3\n", nil},
+			},
+		},
+		{
+			patches: []*node{
+				{"0001-x.patch", xPatch("5", "6"), nil},
+			},
+			werr: true,
+		},
+		{ // new patches for a saved dependency need update
+			godeps: godeps("C", "D", "D1"),
+			patches: []*node{
+				{"0001-x.patch", xPatch("1", "2"), nil},
+			},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		c := []*node{
+			{"main.go", pkg("main", "D"), nil},
+			{"Godeps/patches/D", "", test.patches},
+			{"+git", "", nil},
+		}
+		if test.godeps != nil {
+			c = append(c, &node{"Godeps/Godeps.json", test.godeps, nil})
+		}
+		makeTree(t, &node{src, "", []*node{
+			{
+				"D",
+				"",
+				[]*node{
+					{"main.go", pkg("D") + decl("D1"), nil},
+					{"x.go", "package D\n\nvar X = 1\n", nil},
+					{"+git", "D1", nil},
+				},
+			},
+			{"C", "", c},
+		}}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = save(nil)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d save err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if err == nil {
+			g, err := loadDefaultGodepsFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(g.Deps) != 1 || len(g.Deps[0].Patches) != len(test.patches) {
+				t.Errorf("%d saved deps = %+v want %d patches", pos, g.Deps, len(test.patches))
+			}
+			drifts, err := verify(g.Deps, relativeVendorTarget(false))
+			if err != nil || len(drifts) > 0 {
+				t.Errorf("%d verify = %v, %v want no drift", pos, drifts, err)
+			}
+			gold, gnew, err := loadDiffGOPATH()
+			if err != nil {
+				t.Errorf("%d diff err = %v", pos, err)
+			} else if diff, _ := diffStr(&gold, &gnew); diff != "" {
+				t.Errorf("%d diff = %q want none", pos, diff)
+			}
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		if test.want != nil {
+			checkTree(t, pos, &node{src, "", test.want})
+		}
+	}
+}
@@ -12,6 +12,7 @@ type Package struct {
 	Dir        string
 	Root       string
 	ImportPath string
+	Imports    []string
 	Deps       []string
 	Standard   bool
 
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"path"
+	"sort"
+)
+
+var cmdRemove = &Command{
+	Usage: "remove packages",
+	Short: "remove dependencies and their copied source code",
+	Long: `
+Remove deletes the named dependency packages from Godeps/Godeps.json
+and removes their source code from Godeps/_workspace (or vendor/, if
+the vendor experiment is turned on). As with 'godep update', the '...'
+wildcard can be used to select several packages.
+
+Remove refuses to remove a dependency that is still imported, directly
+or indirectly, by the packages saved in Godeps (or ".", if there are
+none) or by their test files.
+
+If import paths were rewritten by 'godep save -r', any rewritten
+imports of the removed packages are restored to their original form.
+
+For more about specifying packages, see 'go help packages'.
+`,
+	Run: runRemove,
+}
+
+func runRemove(cmd *Command, args []string) {
+	if len(args) == 0 {
+		cmd.UsageExit()
+	}
+	err := remove(args)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func remove(args []string) error {
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		arg := path.Clean(arg)
+		any := markMatches(arg, g.Deps)
+		if !any {
+			log.Println("not in manifest:", arg)
+		}
+	}
+	var rem, keep []Dependency
+	for _, dep := range g.Deps {
+		if dep.matched {
+			rem = append(rem, dep)
+		} else {
+			keep = append(keep, dep)
+		}
+	}
+	if len(rem) == 0 {
+		return errorNoPackagesRemovable
+	}
+
+	pkgs, err := LoadPackages(savedPackages(g.Packages)...)
+	if err != nil {
+		return err
+	}
+	imports, err := allImports(pkgs)
+	if err != nil {
+		return err
+	}
+	var err1 error
+	for _, dep := range rem {
+		for _, imp := range imports {
+			if containsPathPrefix([]string{dep.ImportPath}, imp) {
+				log.Printf("cannot remove %s: %s is still imported", dep.ImportPath, imp)
+				err1 = errorPackagesStillUsed
+				break
+			}
+		}
+	}
+	if err1 != nil {
+		return err1
+	}
+
+	if keep == nil {
+		keep = make([]Dependency, 0) // produce json [], not null
+	}
+	g.Deps = keep
+	if _, err = g.save(); err != nil {
+		return err
+	}
+	err = removeSrc(relativeVendorTarget(VendorExperiment), rem)
+	if err != nil {
+		return err
+	}
+
+	ok, err := needRewrite(g.Packages)
+	if err != nil {
+		return err
+	}
+	var rewritePaths []string
+	if ok {
+		for _, dep := range g.Deps {
+			rewritePaths = append(rewritePaths, dep.ImportPath)
+		}
+	}
+	return rewrite(pkgs, g.ImportPath, rewritePaths)
+}
+
+// allImports returns the unqualified import paths of all packages
+// imported, directly or indirectly, by pkgs or their test files.
+func allImports(pkgs []*Package) ([]string, error) {
+	var a, testImports []string
+	for _, p := range pkgs {
+		a = append(a, p.Deps...)
+		testImports = append(testImports, p.TestImports...)
+		testImports = append(testImports, p.XTestImports...)
+	}
+	ps, err := LoadPackages(testImports...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ps {
+		a = append(a, p.ImportPath)
+		a = append(a, p.Deps...)
+	}
+	for i, s := range a {
+		a[i] = unqualify(s)
+	}
+	sort.Strings(a)
+	return uniq(a), nil
+}
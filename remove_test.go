@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	var cases = []struct {
+		cwd   string
+		args  []string
+		start []*node
+		want  []*node
+		wdep  Godeps
+		werr  bool
+	}{
+		{ // remove an unused dependency
+			cwd:  "C",
+			args: []string{"E"},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", "(absent)", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{ // wildcard
+			cwd:  "C",
+			args: []string{"E/..."},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "E/P", "E1", "E/Q", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"Godeps/_workspace/src/E/P/main.go", pkg("P"), nil},
+						{"Godeps/_workspace/src/E/Q/main.go", pkg("Q"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace/src/E/P/main.go", "(absent)", nil},
+				{"C/Godeps/_workspace/src/E/Q/main.go", "(absent)", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{ // still imported by a test file
+			cwd:  "C",
+			args: []string{"E"},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"main_test.go", pkg("main", "E"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+			werr: true,
+		},
+		{ // still imported indirectly, through rewritten imports
+			cwd:  "C",
+			args: []string{"E"},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/E"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+					{ImportPath: "E", Comment: "E1"},
+				},
+			},
+			werr: true,
+		},
+		{ // rewritten imports of remaining dependencies are kept
+			cwd:  "C",
+			args: []string{"E"},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/E/main.go", "(absent)", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+		},
+		{ // not in manifest
+			cwd:  "C",
+			args: []string{"F"},
+			start: []*node{
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		dir := filepath.Join(wd, src, test.cwd)
+		err = os.Chdir(dir)
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = remove(test.args)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d remove err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+
+		f, err := os.Open(filepath.Join(dir, "Godeps/Godeps.json"))
+		if err != nil {
+			t.Error(err)
+		}
+		g := new(Godeps)
+		err = json.NewDecoder(f).Decode(g)
+		if err != nil {
+			t.Error(err)
+		}
+		f.Close()
+
+		for i := range g.Deps {
+			g.Deps[i].Rev = ""
+		}
+		if !reflect.DeepEqual(g.Deps, test.wdep.Deps) {
+			t.Errorf("%d Deps = %v want %v", pos, g.Deps, test.wdep.Deps)
+		}
+	}
+}
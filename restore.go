@@ -1,23 +1,95 @@
 package main
 
 import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/tools/godep/Godeps/_workspace/src/github.com/kr/fs"
+	"github.com/tools/godep/Godeps/_workspace/src/golang.org/x/tools/go/vcs"
 )
 
 var cmdRestore = &Command{
-	Usage: "restore [-v]",
+	Usage: "restore [-v] [-j n] [-from-workspace]",
 	Short: "check out listed dependency versions in GOPATH",
 	Long: `
 Restore checks out the Godeps-specified version of each package in GOPATH.
+Each repository is checked out once, so all packages from the same
+repository must have the same revision in Godeps/Godeps.json.
+
+Repositories missing from GOPATH are downloaded into the first GOPATH
+entry first. Up to n repositories are downloaded and checked out at a
+time, as given by -j. The default is the number of CPUs. Errors are
+reported in the order of the dependencies in Godeps/Godeps.json.
+
+Dependencies with a Repo in Godeps/Godeps.json, such as forks, are
+downloaded from that URL. Otherwise repositories are downloaded from
+the mirrors given in the godep configuration file, if any match.
+The file is named by $GODEP_CONFIG, or is $HOME/.godep/config.json
+by default. It is a JSON object of the following form:
+
+	{
+		"Mirrors": [
+			{"Prefix": "github.com/", "URL": "https://git.example.com/mirror/"},
+			{"Prefix": "golang.org/x/net", "URL": "https://git.example.com/x/net", "VCS": "git"}
+		]
+	}
+
+The mirror with the longest matching Prefix is used. For import paths
+on sites that godep knows, such as github.com, the Prefix in the
+repository root is replaced by the URL, so github.com/a/b is
+downloaded from https://git.example.com/mirror/a/b. For other sites
+the Prefix must be the repository root, and the URL is the
+repository. VCS is needed if it cannot be told from the import path;
+the default is git.
+
+Dependencies with an Archive are downloaded from its URL and unpacked
+into the first GOPATH entry, replacing the directory only if it was
+unpacked from an archive before. If all files in the archive are in
+one top directory, its contents are unpacked. The hash of the source
+is checked before anything in GOPATH is replaced.
+
+If a dependency has Submodules, restore checks out the submodules of
+its repository at the commits recorded there, and checks that they
+match.
+
+If Godeps records a hash of the source of a dependency, restore checks
+that the source checked out in GOPATH has the same hash.
+
+Dependencies saved with uncommitted changes (see 'godep help save')
+are checked out at their revision, without the changes, and with a
+warning. Their hash is not checked.
+
+If -from-workspace is given, restore does not download or check out
+anything. Instead it copies the source code of each dependency from
+Godeps/_workspace (or vendor/, if the vendor experiment is turned on)
+into the first GOPATH entry, and marks each copied directory with a
+file named .godep-workspace. The copies have no version control
+information, so they cannot be saved again by godep; use this only
+where repositories cannot be downloaded. Directories already in
+GOPATH are not replaced, unless they were copied by an earlier
+restore -from-workspace.
 
 If -v is given, verbose output is enabled.
 `,
 	Run: runRestore,
 }
 
+var (
+	restoreJ             int
+	restoreFromWorkspace bool
+)
+
 func init() {
 	cmdRestore.Flag.BoolVar(&verbose, "v", false, "enable verbose output")
+	cmdRestore.Flag.IntVar(&restoreJ, "j", runtime.NumCPU(), "number of repositories to restore in parallel")
+	cmdRestore.Flag.BoolVar(&restoreFromWorkspace, "from-workspace", false, "copy dependencies from the Godeps workspace")
 }
 
 func runRestore(cmd *Command, args []string) {
@@ -25,58 +97,460 @@ func runRestore(cmd *Command, args []string) {
 	if err != nil {
 		log.Fatalln(err)
 	}
-	hadError := false
-	for _, dep := range g.Deps {
-		err := download(dep)
+	if restoreFromWorkspace {
+		err = restoreWorkspace(g.Deps, relativeVendorTarget(VendorExperiment))
+	} else {
+		err = restoreDeps(g.Deps, restoreJ)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// A repoDeps is a repository and the dependencies in it.
+type repoDeps struct {
+	root string        // import path of the repo root
+	ws   string        // GOPATH entry containing the repo, if present
+	rr   *vcs.RepoRoot // how to download the repo, if not present
+	deps []Dependency
+	errs []error
+}
+
+// dir returns the full path to the repo in GOPATH.
+func (r *repoDeps) dir() string {
+	return filepath.Join(r.ws, "src", filepath.FromSlash(r.root))
+}
+
+// restoreDeps downloads and checks out deps in GOPATH, working on
+// up to n repositories at a time. Errors are logged in the order
+// of deps, after all repositories are done. Dependencies from
+// archives are unpacked first.
+func restoreDeps(deps []Dependency, n int) error {
+	warnDirty(deps)
+	var vdeps []Dependency
+	var archives []*Archive
+	byArchive := make(map[Archive][]Dependency)
+	for _, dep := range deps {
+		if dep.Archive == nil {
+			vdeps = append(vdeps, dep)
+			continue
+		}
+		if byArchive[*dep.Archive] == nil {
+			archives = append(archives, dep.Archive)
+		}
+		byArchive[*dep.Archive] = append(byArchive[*dep.Archive], dep)
+	}
+	errs := make([]error, len(archives))
+	parallel(len(archives), n, func(i int) {
+		errs[i] = restoreArchive(archives[i], byArchive[*archives[i]])
+	})
+	var err1 error
+	for _, err := range errs {
 		if err != nil {
-			log.Println("restore, during download dep:", err)
+			log.Println("restore, during restore dep:", err)
+			err1 = errorRestoringDeps
+		}
+	}
+	if len(vdeps) == 0 {
+		return err1
+	}
+	if err := restoreRepos(vdeps, n); err != nil {
+		return err
+	}
+	return err1
+}
+
+// restoreRepos downloads and checks out deps in GOPATH, working on
+// up to n repositories at a time. Errors are logged in the order
+// of deps, after all repositories are done.
+func restoreRepos(deps []Dependency, n int) error {
+	repos, err := groupByRepo(deps, n)
+	if err != nil {
+		log.Println("restore:", err)
+		return errorRestoringDeps
+	}
+	parallel(len(repos), n, func(i int) {
+		r := repos[i]
+		if len(r.errs) > 0 {
+			return
+		}
+		err := download(r)
+		if err != nil {
+			r.errs = append(r.errs, err)
+		}
+	})
+	if logRepoErrors(repos, "restore, during download dep:") {
+		return errorRestoringDeps
+	}
+	parallel(len(repos), n, func(i int) {
+		restore(repos[i])
+	})
+	if logRepoErrors(repos, "restore, during restore dep:") {
+		return errorRestoringDeps
+	}
+	return nil
+}
+
+// logRepoErrors logs the errors of each of repos, in order,
+// with the given prefix. It reports whether there were any.
+func logRepoErrors(repos []*repoDeps, prefix string) bool {
+	hadError := false
+	for _, r := range repos {
+		for _, err := range r.errs {
+			log.Println(prefix, err)
 			hadError = true
 		}
 	}
-	if !hadError {
-		for _, dep := range g.Deps {
-			err := restore(dep)
-			if err != nil {
-				log.Println("restore, during restore dep:", err)
-				hadError = true
+	return hadError
+}
+
+// groupByRepo groups deps by the repository containing them,
+// in the order in which the repositories first appear in deps.
+// Repositories missing from GOPATH are looked up, up to n at
+// a time; lookup errors are recorded in the repoDeps.
+func groupByRepo(deps []Dependency, n int) ([]*repoDeps, error) {
+	var paths []string
+	for _, dep := range deps {
+		paths = append(paths, dep.ImportPath)
+	}
+	ps, err := LoadPackages(paths...)
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]*repoDeps, len(deps))
+	var missing []int
+	for i, dep := range deps {
+		repos[i] = &repoDeps{root: dep.ImportPath}
+		for _, pkg := range ps {
+			if pkg.ImportPath != dep.ImportPath || pkg.Error.Err != "" || pkg.Dir == "" {
+				continue
+			}
+			_, root, err := VCSFromDir(pkg.Dir, filepath.Join(pkg.Root, "src"))
+			if err == nil {
+				repos[i].root = filepath.ToSlash(root)
+				repos[i].ws = pkg.Root
 			}
 		}
+		if repos[i].ws == "" {
+			missing = append(missing, i)
+		}
 	}
-	if hadError {
-		os.Exit(1)
+	parallel(len(missing), n, func(k int) {
+		i := missing[k]
+		r := repos[i]
+		rr, err := repoRootForImportPath(r.root)
+		if err != nil {
+			r.errs = append(r.errs, err)
+			return
+		}
+		if repo := deps[i].Repo; repo != "" {
+			rr.Repo = repo
+		}
+		r.root = rr.Root
+		r.rr = rr
+	})
+
+	var a []*repoDeps
+	byRoot := make(map[string]*repoDeps)
+	for i, dep := range deps {
+		r := byRoot[repos[i].root]
+		if r == nil {
+			r = repos[i]
+			byRoot[r.root] = r
+			a = append(a, r)
+		} else {
+			r.errs = append(r.errs, repos[i].errs...)
+			if r.ws == "" {
+				r.ws = repos[i].ws
+			}
+			if r.rr == nil {
+				r.rr = repos[i].rr
+			}
+		}
+		r.deps = append(r.deps, dep)
 	}
+	return a, nil
 }
 
-// download downloads the given dependency.
-func download(dep Dependency) error {
-	// make sure pkg exists somewhere in GOPATH
+// parallel calls fn(i) for each i in [0, count),
+// using up to n goroutines at a time.
+func parallel(count, n int, fn func(i int)) {
+	if n < 1 {
+		n = 1
+	}
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < n && j < count; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+}
 
-	args := []string{"get", "-d"}
+// download makes sure the repository of r exists somewhere
+// in GOPATH, downloading it into the first entry if needed.
+func download(r *repoDeps) error {
+	if r.ws != "" {
+		return nil
+	}
+	r.ws = firstGOPATH()
+	dir := r.dir()
+	if _, err := os.Stat(dir); err == nil {
+		return nil // downloaded by an earlier run
+	}
 	if verbose {
-		args = append(args, "-v")
+		fmt.Printf("download %s from %s\n", r.root, r.rr.Repo)
 	}
+	err := os.MkdirAll(filepath.Dir(dir), 0777)
+	if err != nil {
+		return err
+	}
+	err = createRepo(r.rr.VCS, r.rr.Repo, dir)
+	if err != nil {
+		return fmt.Errorf("%s: %v", r.root, err)
+	}
+	return nil
+}
 
-	return runIn(".", "go", append(args, dep.ImportPath)...)
+// firstGOPATH returns the first entry of GOPATH.
+func firstGOPATH() string {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		gopath = build.Default.GOPATH
+	}
+	return filepath.SplitList(gopath)[0]
 }
 
-// restore checks out the given revision.
-func restore(dep Dependency) error {
-	ps, err := LoadPackages(dep.ImportPath)
+// restore checks out the revision of the dependencies in r,
+// once for the whole repository. The dependencies must all have
+// the same revision. Errors are recorded in r.errs.
+func restore(r *repoDeps) {
+	rev, repo := r.deps[0].Rev, r.deps[0].Repo
+	for _, dep := range r.deps[1:] {
+		if dep.Rev != rev {
+			r.errs = append(r.errs, fmt.Errorf("%s: inconsistent revisions: %s at %s, %s at %s",
+				r.root, r.deps[0].ImportPath, rev, dep.ImportPath, dep.Rev))
+		}
+		if dep.Repo != repo {
+			r.errs = append(r.errs, fmt.Errorf("%s: inconsistent repositories: %s from %q, %s from %q",
+				r.root, r.deps[0].ImportPath, repo, dep.ImportPath, dep.Repo))
+		}
+	}
+	if len(r.errs) > 0 {
+		return
+	}
+
+	dir := r.dir()
+	v, _, err := VCSFromDir(dir, filepath.Join(r.ws, "src"))
+	if err != nil {
+		r.errs = append(r.errs, err)
+		return
+	}
+	if !v.exists(dir, rev) {
+		v.vcs.Download(dir)
+	}
+	err = v.RevSync(dir, rev)
 	if err != nil {
+		if remote, _ := v.remote(dir); repo != "" && remote != repo {
+			err = fmt.Errorf("%v (repository in GOPATH is from %s, not %s)", err, remote, repo)
+		}
+		r.errs = append(r.errs, fmt.Errorf("%s: cannot check out revision %s: %v", r.root, rev, err))
+		return
+	}
+	if hasSubmodules(r.deps) {
+		err = v.run(dir, v.SubmoduleSyncCmd)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: cannot check out submodules: %v", r.root, err))
+			return
+		}
+	}
+	for _, dep := range r.deps {
+		depdir := filepath.Join(r.ws, "src", filepath.FromSlash(dep.ImportPath))
+		if len(dep.Submodules) > 0 {
+			subs, err := v.submodules(depdir)
+			if err != nil {
+				r.errs = append(r.errs, fmt.Errorf("%s: %v", dep.ImportPath, err))
+				continue
+			}
+			if !reflect.DeepEqual(subs, dep.Submodules) {
+				r.errs = append(r.errs, fmt.Errorf("%s: submodules at revision %s are %v, want %v", dep.ImportPath, dep.Rev, subs, dep.Submodules))
+				continue
+			}
+		}
+		if dep.Hash == "" || dep.Dirty != "" {
+			continue
+		}
+		dep.vcs = v
+		dep.ws = r.ws
+		dep.dir = depdir
+		h, err := hashSrc(dep)
+		if err != nil {
+			r.errs = append(r.errs, err)
+			continue
+		}
+		if h != dep.Hash {
+			r.errs = append(r.errs, fmt.Errorf("%s: hash of source at revision %s is %s, want %s", dep.ImportPath, dep.Rev, h, dep.Hash))
+		}
+	}
+}
+
+// hasSubmodules reports whether any of deps has submodules.
+func hasSubmodules(deps []Dependency) bool {
+	for _, dep := range deps {
+		if len(dep.Submodules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceMarker is the name of the file that marks
+// a directory copied by restore -from-workspace.
+const workspaceMarker = ".godep-workspace"
+
+// restoreWorkspace copies the source code of deps from srcdir
+// into the first GOPATH entry, marking the top directory of each
+// copy with workspaceMarker. Errors are logged.
+func restoreWorkspace(deps []Dependency, srcdir string) error {
+	dst := filepath.Join(firstGOPATH(), "src")
+	var err1 error
+	for _, dep := range deps {
+		err := restoreCopy(dep, srcdir, dst)
+		if err != nil {
+			log.Println("restore:", err)
+			err1 = errorRestoringDeps
+		}
+	}
+	return err1
+}
+
+// restoreCopy copies the directory of the package dep, with its
+// subdirectories, from srcdir to dst, along with any files in its
+// parent directories that are missing from dst, such as license
+// files in the repo root.
+func restoreCopy(dep Dependency, srcdir, dst string) error {
+	rel := filepath.FromSlash(dep.ImportPath)
+	from, to := filepath.Join(srcdir, rel), filepath.Join(dst, rel)
+	if _, err := os.Stat(from); err != nil {
 		return err
 	}
-	pkg := ps[0]
+	inCopy := workspaceCopyRoot(filepath.Dir(to), dst) != ""
+	if _, err := os.Stat(filepath.Join(to, workspaceMarker)); err == nil || inCopy {
+		err = os.RemoveAll(to)
+		if err != nil {
+			return err
+		}
+	} else if uncopiedFile(to) != "" {
+		return fmt.Errorf("%s: already in GOPATH at %s, not replacing", dep.ImportPath, to)
+	}
+	w := fs.Walk(from)
+	for w.Step() {
+		if w.Err() != nil {
+			return w.Err()
+		}
+		if w.Stat().IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(from, w.Path())
+		if err != nil { // this should never happen
+			return err
+		}
+		name := filepath.Join(to, rel)
+		os.Remove(name) // left by an earlier copy of a subdirectory
+		err = copyFile(name, w.Path())
+		if err != nil {
+			return err
+		}
+	}
+	if !inCopy {
+		err := writeFile(filepath.Join(to, workspaceMarker), fmt.Sprintf(workspaceNote, dep.ImportPath, dep.Rev))
+		if err != nil {
+			return err
+		}
+	}
 
-	dep.vcs, err = VCSForImportPath(dep.ImportPath)
-	if err != nil {
-		dep.vcs, _, err = VCSFromDir(pkg.Dir, pkg.Root)
+	for d := filepath.Dir(rel); d != "."; d = filepath.Dir(d) {
+		fis, err := ioutil.ReadDir(filepath.Join(srcdir, d))
 		if err != nil {
 			return err
 		}
+		for _, fi := range fis {
+			if fi.IsDir() {
+				continue
+			}
+			name := filepath.Join(dst, d, fi.Name())
+			if _, err := os.Lstat(name); err == nil {
+				continue
+			}
+			err = copyFile(name, filepath.Join(srcdir, d, fi.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const workspaceNote = `This directory was copied from a Godeps workspace
+by 'godep restore -from-workspace'. It has no version
+control information. Remove it and run 'godep restore'
+to check out the real repository.
+
+%s %s
+`
+
+// workspaceCopyRoot returns dir or the parent of dir, below top,
+// that holds workspaceMarker, or "" if there is none. If top is
+// "", all parents are searched.
+func workspaceCopyRoot(dir, top string) string {
+	dir = filepath.Clean(dir)
+	if top != "" {
+		top = filepath.Clean(top)
+	}
+	for d := dir; d != top; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, workspaceMarker)); err == nil {
+			return d
+		}
+		if d == filepath.Dir(d) {
+			break
+		}
 	}
+	return ""
+}
+
+// uncopiedFile returns the name of a file in the tree at dir
+// that was not copied by restore -from-workspace, or "".
+func uncopiedFile(dir string) string {
+	w := fs.Walk(dir)
+	for w.Step() {
+		if w.Err() != nil {
+			continue
+		}
+		if w.Stat().IsDir() {
+			if _, err := os.Stat(filepath.Join(w.Path(), workspaceMarker)); err == nil {
+				w.SkipDir()
+			}
+			continue
+		}
+		return w.Path()
+	}
+	return ""
+}
 
-	if !dep.vcs.exists(pkg.Dir, dep.Rev) {
-		dep.vcs.vcs.Download(pkg.Dir)
+// checkWorkspaceCopy returns an error if dir, or a directory
+// containing it, was copied by restore -from-workspace.
+func checkWorkspaceCopy(dir string) error {
+	if workspaceCopyRoot(dir, "") != "" {
+		return fmt.Errorf("%s was copied by 'godep restore -from-workspace' and has no version control information; remove it and run 'godep restore'", dir)
 	}
-	return dep.vcs.RevSync(pkg.Dir, dep.Rev)
+	return nil
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	var cases = []struct {
+		start []*node
+		want  []*node
+		werr  bool
+	}{
+		{ // check out saved revisions, several packages per repo
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("E1"), nil},
+						{"B/main.go", pkg("B") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"A/main.go", pkg("A") + decl("E2"), nil},
+						{"B/main.go", pkg("B") + decl("E2"), nil},
+						{"+git", "E2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E/A", "E/B"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E/A", "E1", "E/B", "E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"D/main.go", pkg("D") + decl("D1"), nil},
+				{"E/A/main.go", pkg("A") + decl("E1"), nil},
+				{"E/B/main.go", pkg("B") + decl("E1"), nil},
+			},
+		},
+		{ // inconsistent revisions in one repo
+			start: []*node{
+				{
+					"E",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("E1"), nil},
+						{"B/main.go", pkg("B") + decl("E1"), nil},
+						{"+git", "E1", nil},
+						{"A/main.go", pkg("A") + decl("E2"), nil},
+						{"B/main.go", pkg("B") + decl("E2"), nil},
+						{"+git", "E2", nil},
+						{"A/main.go", pkg("A") + decl("E3"), nil},
+						{"B/main.go", pkg("B") + decl("E3"), nil},
+						{"+git", "E3", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "E/A", "E/B"), nil},
+						{"Godeps/Godeps.json", godeps("C", "E/A", "E1", "E/B", "E2"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"E/A/main.go", pkg("A") + decl("E3"), nil},
+				{"E/B/main.go", pkg("B") + decl("E3"), nil},
+			},
+			werr: true,
+		},
+		{ // a repo cannot be found, nothing is checked out
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "F"), nil},
+						{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "F", "F1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"D/main.go", pkg("D") + decl("D2"), nil},
+			},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		g, err := loadDefaultGodepsFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = restoreDeps(g.Deps, 2)
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d restoreDeps err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+	}
+}
+
+func TestRestoreFromWorkspace(t *testing.T) {
+	workspace := []*node{
+		{"main.go", pkg("main", "D", "E/P"), nil},
+		{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "E/P", "E1"), nil},
+		{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+		{"Godeps/_workspace/src/D/sub/sub.go", pkg("sub") + decl("D1"), nil},
+		{"Godeps/_workspace/src/E/LICENSE", "(c) E", nil},
+		{"Godeps/_workspace/src/E/P/main.go", pkg("P") + decl("E1"), nil},
+	}
+	var cases = []struct {
+		start []*node
+		want  []*node
+		werr  bool
+	}{
+		{ // copy into an empty GOPATH
+			start: []*node{
+				{"C", "", workspace},
+			},
+			want: []*node{
+				{"D/main.go", pkg("D") + decl("D1"), nil},
+				{"D/.godep-workspace", fmt.Sprintf(workspaceNote, "D", ""), nil},
+				{"D/sub/sub.go", pkg("sub") + decl("D1"), nil},
+				{"D/sub/.godep-workspace", "(absent)", nil},
+				{"E/LICENSE", "(c) E", nil},
+				{"E/P/main.go", pkg("P") + decl("E1"), nil},
+				{"E/P/.godep-workspace", fmt.Sprintf(workspaceNote, "E/P", ""), nil},
+			},
+		},
+		{ // replace an earlier copy
+			start: []*node{
+				{"C", "", workspace},
+				{"D/old.go", pkg("D"), nil},
+				{"D/.godep-workspace", "", nil},
+			},
+			want: []*node{
+				{"D/main.go", pkg("D") + decl("D1"), nil},
+				{"D/old.go", "(absent)", nil},
+				{"D/sub/sub.go", pkg("sub") + decl("D1"), nil},
+			},
+		},
+		{ // keep a checkout that is already in GOPATH
+			start: []*node{
+				{"C", "", workspace},
+				{"D/main.go", pkg("D") + decl("D2"), nil},
+				{"E/LICENSE", "(c) E2", nil},
+			},
+			want: []*node{
+				{"D/main.go", pkg("D") + decl("D2"), nil},
+				{"D/.godep-workspace", "(absent)", nil},
+				{"E/LICENSE", "(c) E2", nil},
+				{"E/P/main.go", pkg("P") + decl("E1"), nil},
+			},
+			werr: true,
+		},
+		{ // keep a checkout with files only in subdirectories
+			start: []*node{
+				{"C", "", workspace},
+				{"D/sub/sub.go", pkg("sub") + decl("D2"), nil},
+			},
+			want: []*node{
+				{"D/main.go", "(absent)", nil},
+				{"D/sub/sub.go", pkg("sub") + decl("D2"), nil},
+			},
+			werr: true,
+		},
+		{ // nested package listed too
+			start: []*node{
+				{"C", "", []*node{
+					{"main.go", pkg("main", "D", "D/sub"), nil},
+					{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "D/sub", "D1"), nil},
+					{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+					{"Godeps/_workspace/src/D/sub/sub.go", pkg("sub") + decl("D1"), nil},
+				}},
+			},
+			want: []*node{
+				{"D/main.go", pkg("D") + decl("D1"), nil},
+				{"D/sub/sub.go", pkg("sub") + decl("D1"), nil},
+				{"D/sub/.godep-workspace", "(absent)", nil},
+			},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		g, err := loadDefaultGodepsFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = restoreWorkspace(g.Deps, relativeVendorTarget(false))
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d restoreWorkspace err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		if !test.werr {
+			// The copies cannot be saved.
+			pkgs, err := LoadPackages(".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gnew := &Godeps{ImportPath: "C"}
+			if err = gnew.fill(pkgs, "C"); err == nil {
+				t.Errorf("%d fill err = nil want error", pos)
+			}
+		}
+		log.SetOutput(os.Stderr)
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+	}
+}
+
+func TestRestoreFork(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork := filepath.Join(wd, gopath, "fork", "D")
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{fork, "", []*node{
+		{"main.go", pkg("D") + decl("D1"), nil},
+		{"+git", "D1", nil},
+		{"main.go", pkg("D") + decl("D2"), nil},
+		{"+git", "D2", nil},
+	}}, "")
+	err = os.MkdirAll(src, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := "file://" + fork
+	deps := []Dependency{{
+		ImportPath: "github.com/a/D",
+		Rev:        strings.TrimSpace(run(t, fork, "git", "rev-parse", "D1")),
+		Repo:       repo,
+	}}
+
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	log.SetOutput(ioutil.Discard)
+	err = restoreDeps(deps, 1)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"github.com/a/D/main.go", pkg("D") + decl("D1"), nil},
+	}})
+	dir := filepath.Join(src, "github.com", "a", "D")
+	if g := strings.TrimSpace(run(t, dir, "git", "config", "remote.origin.url")); g != repo {
+		t.Errorf("remote = %q want %q", g, repo)
+	}
+}
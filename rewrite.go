@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -16,6 +17,10 @@ import (
 	"github.com/tools/godep/Godeps/_workspace/src/github.com/kr/fs"
 )
 
+// rewriteDryRun, if set, makes rewrite print the names of the
+// files it would change instead of changing them.
+var rewriteDryRun bool
+
 // rewrite visits the go files in pkgs, plus all go files
 // in the directory tree Godeps, rewriting import statments
 // according to the rules for func qualify.
@@ -93,6 +98,10 @@ func rewriteGoFile(name, qual string, paths []string) error {
 	if !changed {
 		return nil
 	}
+	if rewriteDryRun {
+		fmt.Println(name)
+		return nil
+	}
 	var buffer bytes.Buffer
 	if err = printerConfig.Fprint(&buffer, fset, f); err != nil {
 		return err
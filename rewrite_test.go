@@ -264,3 +264,78 @@ func TestRewrite(t *testing.T) {
 		checkTree(t, pos, &node{src, "", test.want})
 	}
 }
+
+func TestUnrewrite(t *testing.T) {
+	start := []*node{
+		{
+			"C",
+			"",
+			[]*node{
+				{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"Godeps/Godeps.json", godepsJSON("C", "D", "D1", "T", "T1"), nil},
+				{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+				{"Godeps/_workspace/src/T/main.go", pkg("T"), nil},
+			},
+		},
+	}
+	var cases = []struct {
+		dryRun bool
+		want   []*node
+	}{
+		{
+			dryRun: true,
+			want: []*node{
+				{"C/main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/T"), nil},
+			},
+		},
+		{
+			dryRun: false,
+			want: []*node{
+				{"C/main.go", pkg("main", "D"), nil},
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D", "T"), nil},
+				{"C/Godeps/_workspace/src/T/main.go", pkg("T"), nil},
+			},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	defer func() { rewriteDryRun = false }()
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", start}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		rewriteDryRun = test.dryRun
+		stdout := os.Stdout
+		os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		err = unrewrite(nil)
+		os.Stdout.Close()
+		os.Stdout = stdout
+		if err != nil {
+			t.Errorf("%d unrewrite err = %v", pos, err)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", test.want})
+	}
+}
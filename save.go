@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 
@@ -17,7 +18,7 @@ import (
 )
 
 var cmdSave = &Command{
-	Usage: "save [-r] [-v] [-t] [packages]",
+	Usage: "save [-r] [-v] [-t] [-allow-dirty] [packages]",
 	Short: "list and copy dependencies into Godeps",
 	Long: `
 
@@ -40,9 +41,38 @@ The dependency list is a JSON document with the following structure:
 			ImportPath string
 			Comment    string // Tag or description of commit.
 			Rev        string // VCS-specific commit ID.
+			Hash       string // Hash of the copied source, if present.
+			Repo       string // Repository URL, if not the usual one.
+			Archive    *struct {
+				URL  string // URL or path of a .tar.gz, .tgz or .zip file.
+				Root string // Import path of the top directory of the archive.
+			}
+			Submodules []struct {
+				Path string // Relative to the dependency's directory.
+				Rev  string // VCS-specific commit ID.
+			}
+			LFS        string // Policy for Git LFS pointer files, if any.
+			Dirty      string // Hash of uncommitted changes, if saved with -allow-dirty.
+			Patches    []struct {
+				Name string // File name in Godeps/patches/<import path>.
+				Hash string // SHA-256 hash of the patch file.
+			}
 		}
 	}
 
+Repo is set when the default remote of the dependency's repository
+in GOPATH is not the repository that go get would use for its import
+path, as for a fork kept under the original import path. Restore
+downloads the dependency from Repo. Save does not look up import paths
+on the network, so Repo is set only for well-known sites such as
+github.com and for import paths with a mirror (see 'godep help restore').
+
+Archive is set, and Rev is empty, for a dependency that is not under
+version control but was unpacked from a release archive. The top
+directory of such a dependency in GOPATH must contain a file named
+.godep-archive, whose first line is the URL of the archive. All files
+of the dependency are copied, not only those tracked by a VCS.
+
 Any packages already present in the list will be left unchanged.
 To update a dependency to a newer revision, use 'godep update'.
 
@@ -55,6 +85,53 @@ If -v is given, verbose output is enabled.
 If -t is given, test files (*_test.go files + testdata directories) are
 also saved.
 
+Save fails if a dependency's working tree has uncommitted changes. If
+-allow-dirty is given, the working tree is copied anyway, and Dirty
+records a hash of the changes along with the revision they are on.
+Such a dependency cannot be restored as saved, so restore and godep go
+warn about it.
+
+Patches in Godeps/patches/<import path>/*.patch are applied, in name
+order, to the copied source of the dependency with that import path,
+and are recorded in Patches. File names in the patches are relative to
+the directory of the dependency, with one leading component, as in the
+output of git diff. If a patch does not apply, save fails before
+writing anything. Patches are applied only when a dependency is
+copied; use 'godep update' to apply changed patches to a dependency
+already in Godeps/Godeps.json.
+
+Git, Mercurial, Bazaar and Subversion are supported. The source in git
+submodules is copied too, and the commit of each submodule in the
+dependency's directory is recorded in Submodules. Submodules must be
+checked out at the commits recorded in their parent repository. The godep
+configuration file (see 'godep help restore') can change the commands
+godep runs for these, or add other systems, under the key "VCS":
+
+	{
+		"VCS": {
+			"git": {"DescribeCmd": "describe --tags --always"},
+			"myvcs": {
+				"Marker":      ".myvcs",
+				"CreateCmd":   "checkout {repo} {dir}",
+				"IdentifyCmd": "current-revision",
+				...
+			}
+		}
+	}
+
+Each key is the name of the command. The templates are IdentifyCmd,
+DescribeCmd, DiffCmd, ListCmd, LogCmd, RootCmd, ShowCmd, RemoteCmd,
+SyncCmd, ResolveCmd, ExistsCmd and HeadCmd, as in the VCS type in
+godep's source.
+A new system also needs Marker, a file or directory in the root of
+each repository, and CreateCmd; restore also uses DownloadCmd and
+SyncCmd. Commands a system lacks fail with an error.
+
+Save and update fail if a dependency has Git LFS pointer files in
+place of their content. To change this, set LFS for the dependency
+in Godeps/Godeps.json to "fetch", to run 'git lfs pull' for those
+files, or to "keep", to copy the pointer files as they are.
+
 For more about specifying packages, see 'go help packages'.
 `,
 	Run: runSave,
@@ -68,6 +145,7 @@ func init() {
 	cmdSave.Flag.BoolVar(&verbose, "v", false, "enable verbose output")
 	cmdSave.Flag.BoolVar(&saveR, "r", false, "rewrite import paths")
 	cmdSave.Flag.BoolVar(&saveT, "t", false, "save test files")
+	cmdSave.Flag.BoolVar(&allowDirty, "allow-dirty", false, "copy uncommitted changes in dependencies")
 }
 
 func runSave(cmd *Command, args []string) {
@@ -112,6 +190,7 @@ func save(pkgs []string) error {
 	gnew := &Godeps{
 		ImportPath: dot.ImportPath,
 		GoVersion:  ver,
+		prev:       gold.Deps,
 	}
 
 	switch len(pkgs) {
@@ -129,6 +208,10 @@ func save(pkgs []string) error {
 	if err != nil {
 		return err
 	}
+	err = setPatches(gnew.Deps)
+	if err != nil {
+		return err
+	}
 	if gnew.Deps == nil {
 		gnew.Deps = make([]Dependency, 0) // produce json [], not null
 	}
@@ -147,6 +230,10 @@ func save(pkgs []string) error {
 		}
 		gold = Godeps{}
 	}
+	err = checkPatches(subDeps(gnew.Deps, gold.Deps))
+	if err != nil {
+		return err
+	}
 	os.Remove("Godeps") // remove regular file if present; ignore error
 	readme := filepath.Join("Godeps", "Readme")
 	err = writeFile(readme, strings.TrimSpace(Readme)+"\n")
@@ -172,6 +259,10 @@ func save(pkgs []string) error {
 	if err != nil {
 		return err
 	}
+	err = patchSrc(srcdir, add)
+	if err != nil {
+		return err
+	}
 	if !VendorExperiment {
 		f, _ := filepath.Split(srcdir)
 		writeVCSIgnore(f)
@@ -197,7 +288,7 @@ func (v *revError) Error() string {
 		"Run `godep update %s' first.", v.ImportPath, v.WantRev, v.HavePath, v.HaveRev, v.HavePath)
 }
 
-// carryVersions copies Rev and Comment from a to b for
+// carryVersions copies the version fields, such as Rev and Hash, from a to b for
 // each dependency with an identical ImportPath. For any
 // dependency in b that appears to be from the same repo
 // as one in a (for example, a parent or child directory),
@@ -216,8 +307,23 @@ func carryVersion(a *Godeps, db *Dependency) error {
 	// First see if this exact package is already in the list.
 	for _, da := range a.Deps {
 		if db.ImportPath == da.ImportPath {
+			// Patches are applied only when the source is
+			// copied, so they can't change here.
+			if !reflect.DeepEqual(db.Patches, da.Patches) {
+				return fmt.Errorf("patches for %s have changed; run 'godep update %s' to apply them", db.ImportPath, db.ImportPath)
+			}
+			// Keep the hash computed from GOPATH only if
+			// a has none and the revisions agree.
+			if da.Hash != "" || da.Rev != db.Rev {
+				db.Hash = da.Hash
+			}
 			db.Rev = da.Rev
 			db.Comment = da.Comment
+			db.Repo = da.Repo
+			db.Archive = da.Archive
+			db.Submodules = da.Submodules
+			db.LFS = da.LFS
+			db.Dirty = da.Dirty
 			return nil
 		}
 	}
@@ -283,46 +389,10 @@ func copySrc(dir string, deps []Dependency) error {
 			ok = false
 		}
 
-		// copy actual dependency
-		vf := dep.vcs.listFiles(dep.dir)
-		w := fs.Walk(dep.dir)
-		for w.Step() {
-			err = copyPkgFile(vf, dir, srcdir, w)
-			if err != nil {
-				log.Println(err)
-				ok = false
-			}
-		}
-
-		// Look for legal files in root
-		//  some packages are imports as a sub-package but license info
-		//  is at root:  exampleorg/common has license file in exampleorg
-		//
-		if dep.ImportPath == dep.root {
-			// we are already at root
-			continue
-		}
-
-		// prevent copying twice This could happen if we have
-		//   two subpackages listed someorg/common and
-		//   someorg/anotherpack which has their license in
-		//   the parent dir of someorg
-		rootdir := filepath.Join(srcdir, filepath.FromSlash(dep.root))
-		if visited[rootdir] {
-			continue
-		}
-		visited[rootdir] = true
-		vf = dep.vcs.listFiles(rootdir)
-		w = fs.Walk(rootdir)
-		for w.Step() {
-			fname := filepath.Base(w.Path())
-			if IsLegalFile(fname) && !strings.Contains(w.Path(), sep) {
-				err = copyPkgFile(vf, dir, srcdir, w)
-				if err != nil {
-					log.Println(err)
-					ok = false
-				}
-			}
+		if !walkSrc(dep, visited, func(rel, path string) error {
+			return copyFile(filepath.Join(dir, rel), path)
+		}) {
+			ok = false
 		}
 	}
 
@@ -333,7 +403,63 @@ func copySrc(dir string, deps []Dependency) error {
 	return nil
 }
 
-func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker) error {
+// A copyFunc copies the file at path to rel, a path relative to
+// the root of the copied source tree.
+type copyFunc func(rel, path string) error
+
+// walkSrc calls fn for each file of dep that belongs in the copied
+// source tree. Legal files in the repo root are visited only if
+// the root is not already recorded in visited. Errors are logged,
+// and walkSrc reports whether there were none.
+func walkSrc(dep Dependency, visited map[string]bool, fn copyFunc) bool {
+	ok := true
+	srcdir := filepath.Join(dep.ws, "src")
+
+	// copy actual dependency
+	vf := dep.vcs.listFiles(dep.dir)
+	w := fs.Walk(dep.dir)
+	for w.Step() {
+		err := copyPkgFile(vf, srcdir, w, fn)
+		if err != nil {
+			log.Println(err)
+			ok = false
+		}
+	}
+
+	// Look for legal files in root
+	//  some packages are imports as a sub-package but license info
+	//  is at root:  exampleorg/common has license file in exampleorg
+	//
+	if dep.ImportPath == dep.root {
+		// we are already at root
+		return ok
+	}
+
+	// prevent copying twice This could happen if we have
+	//   two subpackages listed someorg/common and
+	//   someorg/anotherpack which has their license in
+	//   the parent dir of someorg
+	rootdir := filepath.Join(srcdir, filepath.FromSlash(dep.root))
+	if visited[rootdir] {
+		return ok
+	}
+	visited[rootdir] = true
+	vf = dep.vcs.listFiles(rootdir)
+	w = fs.Walk(rootdir)
+	for w.Step() {
+		fname := filepath.Base(w.Path())
+		if IsLegalFile(fname) && !strings.Contains(w.Path(), sep) {
+			err := copyPkgFile(vf, srcdir, w, fn)
+			if err != nil {
+				log.Println(err)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+func copyPkgFile(vf vcsFiles, srcroot string, w *fs.Walker, fn copyFunc) error {
 	if w.Err() != nil {
 		return w.Err()
 	}
@@ -346,6 +472,9 @@ func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker) error {
 		}
 		return nil
 	}
+	if name == archiveMarker {
+		return nil
+	}
 	rel, err := filepath.Rel(srcroot, w.Path())
 	if err != nil { // this should never happen
 		return err
@@ -362,7 +491,7 @@ func copyPkgFile(vf vcsFiles, dstroot, srcroot string, w *fs.Walker) error {
 		}
 		return nil
 	}
-	return copyFile(filepath.Join(dstroot, rel), w.Path())
+	return fn(rel, w.Path())
 }
 
 // copyFile copies a regular file from src to dst.
@@ -394,11 +523,7 @@ func copyFile(dst, src string) error {
 		return err
 	}
 
-	if strings.HasSuffix(dst, ".go") {
-		err = copyWithoutImportComment(w, r)
-	} else {
-		_, err = io.Copy(w, r)
-	}
+	err = copyContents(w, r, dst)
 	err1 := w.Close()
 	if err == nil {
 		err = err1
@@ -407,6 +532,16 @@ func copyFile(dst, src string) error {
 	return err
 }
 
+// copyContents copies r to w the way copyFile copies
+// the contents of a file with the given name.
+func copyContents(w io.Writer, r io.Reader, name string) error {
+	if strings.HasSuffix(name, ".go") {
+		return copyWithoutImportComment(w, r)
+	}
+	_, err := io.Copy(w, r)
+	return err
+}
+
 func copyWithoutImportComment(w io.Writer, r io.Reader) error {
 	b := bufio.NewReader(r)
 	for {
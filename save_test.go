@@ -60,6 +60,16 @@ func godeps(importpath string, keyval ...string) *Godeps {
 	return g
 }
 
+// godepsJSON returns godeps(importpath, keyval...) encoded as JSON,
+// for trees that don't have the dependencies in GOPATH.
+func godepsJSON(importpath string, keyval ...string) string {
+	b, err := json.Marshal(godeps(importpath, keyval...))
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
 func TestSave(t *testing.T) {
 	var cases = []struct {
 		cwd      string
@@ -1179,6 +1189,7 @@ func TestSave(t *testing.T) {
 		}
 		for i := range g.Deps {
 			g.Deps[i].Rev = ""
+			g.Deps[i].Hash = ""
 		}
 		if !reflect.DeepEqual(g.Deps, test.wdep.Deps) {
 			t.Errorf("Deps = %v want %v", g.Deps, test.wdep.Deps)
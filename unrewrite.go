@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+)
+
+var cmdUnrewrite = &Command{
+	Usage: "unrewrite [-n] [packages]",
+	Short: "undo import rewriting done by save -r",
+	Long: `
+Unrewrite restores import statements rewritten by 'godep save -r'
+to their original form, in the named packages and in all go files
+in the Godeps directory tree. If no packages are named, the packages
+saved in Godeps are used, or "." if there are none.
+
+If -n is given, unrewrite prints the names of the files it would
+change, but does not change them.
+
+For more about specifying packages, see 'go help packages'.
+`,
+	Run: runUnrewrite,
+}
+
+func init() {
+	cmdUnrewrite.Flag.BoolVar(&rewriteDryRun, "n", false, "print the files that would change, but do not change them")
+}
+
+func runUnrewrite(cmd *Command, args []string) {
+	err := unrewrite(args)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func unrewrite(args []string) error {
+	// Imports are only ever rewritten into Godeps/_workspace,
+	// even if the vendor experiment is turned on now.
+	defer func(s string) { sep = s }(sep)
+	sep = defaultSep(false)
+
+	pkgs, err := LoadPackages(savedPackages(args)...)
+	if err != nil {
+		return err
+	}
+	for _, p := range pkgs {
+		if p.Error.Err != "" {
+			log.Println(p.Error.Err)
+			err = errorLoadingPackages
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return rewrite(pkgs, "", nil)
+}
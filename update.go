@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"go/parser"
 	"go/token"
+	"io/ioutil"
 	"log"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -12,7 +15,7 @@ import (
 )
 
 var cmdUpdate = &Command{
-	Usage: "update [packages]",
+	Usage: "update [-allow-dirty] [packages]",
 	Short: "use different revision of selected packages",
 	Long: `
 Update changes the named dependency packages to use the
@@ -20,6 +23,22 @@ revision of each currently installed in GOPATH. New code will
 be copied into Godeps and the new revision will be written to
 the manifest.
 
+A package may be followed by @rev, as in foo/bar@v1.2.3, to use
+revision rev instead, which may be a tag, branch or commit of the
+repository in GOPATH; a branch may also be one of its remote, as
+fetched by go get. The revision is checked out in a temporary
+clone of the repository, so the working tree in GOPATH is left
+unchanged. All packages from the same repository must be given
+the same revision.
+
+If -allow-dirty is given, uncommitted changes in the working tree in
+GOPATH are copied too, as with 'godep save -allow-dirty'.
+
+The patches in Godeps/patches for each updated package are applied
+to its copied source again (see 'godep help save'). Update fails if
+a patch no longer applies to the new revision, before changing
+anything.
+
 For more about specifying packages, see 'go help packages'.
 `,
 	Run: runUpdate,
@@ -27,6 +46,7 @@ For more about specifying packages, see 'go help packages'.
 
 func init() {
 	cmdUpdate.Flag.BoolVar(&saveT, "t", false, "save test files during update")
+	cmdUpdate.Flag.BoolVar(&allowDirty, "allow-dirty", false, "copy uncommitted changes in dependencies")
 }
 
 func runUpdate(cmd *Command, args []string) {
@@ -45,25 +65,37 @@ func update(args []string) error {
 		return err
 	}
 	for _, arg := range args {
-		arg := path.Clean(arg)
+		arg, rev := splitRev(arg)
+		arg = path.Clean(arg)
 		any := markMatches(arg, g.Deps)
 		if !any {
 			log.Println("not in manifest:", arg)
 		}
+		if rev != "" {
+			markRev(arg, rev, g.Deps)
+		}
 	}
 	deps, err := LoadVCSAndUpdate(g.Deps)
+	defer removeCheckouts(deps)
 	if err != nil {
 		return err
 	}
 	if len(deps) == 0 {
 		return errorNoPackagesUpdatable
 	}
+	if err = checkPatches(deps); err != nil {
+		return err
+	}
 	if _, err = g.save(); err != nil {
 		return err
 	}
 
 	srcdir := relativeVendorTarget(VendorExperiment)
 	copySrc(srcdir, deps)
+	err = patchSrc(srcdir, deps)
+	if err != nil {
+		return err
+	}
 
 	ok, err := needRewrite(g.Packages)
 	if err != nil {
@@ -129,6 +161,26 @@ func markMatches(pat string, deps []Dependency) (matched bool) {
 	return matched
 }
 
+// markRev sets the wanted revision of each entry in deps
+// with an import path that matches pat to rev.
+func markRev(pat, rev string, deps []Dependency) {
+	f := matchPattern(pat)
+	for i, dep := range deps {
+		if f(dep.ImportPath) {
+			deps[i].wantRev = rev
+		}
+	}
+}
+
+// splitRev splits arg of the form path@rev into
+// path and rev. If arg has no @, rev is empty.
+func splitRev(arg string) (p, rev string) {
+	if i := strings.Index(arg, "@"); i != -1 {
+		return arg[:i], arg[i+1:]
+	}
+	return arg, ""
+}
+
 // matchPattern(pattern)(name) reports whether
 // name matches pattern.  Pattern is a limited glob
 // pattern in which '...' means 'any string' and there
@@ -147,8 +199,9 @@ func matchPattern(pattern string) func(name string) bool {
 	}
 }
 
-// LoadVCSAndUpdate loads and updates a set of dependencies.
-func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
+// loadDeps finds each of deps in GOPATH and fills in
+// its location and version control system.
+func loadDeps(deps []Dependency) error {
 	var err1 error
 	var paths []string
 	for _, dep := range deps {
@@ -156,11 +209,8 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
 	}
 	ps, err := LoadPackages(paths...)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	noupdate := make(map[string]bool) // repo roots
-	var candidates []*Dependency
-	var tocopy []Dependency
 	for i := range deps {
 		dep := &deps[i]
 		for _, pkg := range ps {
@@ -179,18 +229,53 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
 			err1 = errorLoadingDeps
 			continue
 		}
-		vcs, reporoot, err := VCSFromDir(dep.pkg.Dir, filepath.Join(dep.pkg.Root, "src"))
-		if err != nil {
+		if err := checkWorkspaceCopy(dep.pkg.Dir); err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
 		dep.dir = dep.pkg.Dir
 		dep.ws = dep.pkg.Root
+		vcs, reporoot, err := VCSFromDir(dep.pkg.Dir, filepath.Join(dep.pkg.Root, "src"))
+		if err != nil {
+			a, aerr := findArchive(dep.pkg.Dir, filepath.Join(dep.pkg.Root, "src"))
+			if aerr != nil {
+				log.Println(err)
+				err1 = errorLoadingDeps
+				continue
+			}
+			dep.root = a.Root
+			dep.archive = a
+			continue
+		}
 		dep.root = filepath.ToSlash(reporoot)
 		dep.vcs = vcs
+	}
+	return err1
+}
+
+// LoadVCSAndUpdate loads and updates a set of dependencies.
+// Dependencies with a wanted revision are checked out in
+// temporary workspaces, which the caller must remove with
+// removeCheckouts.
+func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
+	var err1 error
+	if err := loadDeps(deps); err != nil {
+		return nil, err
+	}
+	noupdate := make(map[string]bool)  // repo roots
+	wantRev := make(map[string]string) // by repo root
+	var candidates []*Dependency
+	var tocopy []Dependency
+	for i := range deps {
+		dep := &deps[i]
 		if dep.matched {
 			candidates = append(candidates, dep)
+			if rev, ok := wantRev[dep.root]; ok && rev != dep.wantRev {
+				log.Printf("inconsistent revisions for %s: %q and %q", dep.root, rev, dep.wantRev)
+				err1 = errorLoadingDeps
+			}
+			wantRev[dep.root] = dep.wantRev
 		} else {
 			noupdate[dep.root] = true
 		}
@@ -199,29 +284,145 @@ func LoadVCSAndUpdate(deps []Dependency) ([]Dependency, error) {
 		return nil, err1
 	}
 
+	checkouts := make(map[string]string) // workspaces by repo root
 	for _, dep := range candidates {
 		dep.dir = dep.pkg.Dir
 		dep.ws = dep.pkg.Root
 		if noupdate[dep.root] {
 			continue
 		}
-		id, err := dep.vcs.identify(dep.pkg.Dir)
+		if dep.vcs == nil && dep.wantRev != "" {
+			log.Printf("%s is from archive %s, and has no revisions", dep.ImportPath, dep.archive.URL)
+			err1 = errorLoadingDeps
+			break
+		}
+		if dep.wantRev != "" {
+			ws, ok := checkouts[dep.root]
+			if !ok {
+				var err error
+				ws, err = checkoutRev(*dep)
+				if err != nil {
+					log.Println(err)
+					err1 = errorLoadingDeps
+					break
+				}
+				checkouts[dep.root] = ws
+			}
+			dep.ws = ws
+			dep.dir = filepath.Join(ws, "src", filepath.FromSlash(dep.ImportPath))
+			if _, err := os.Stat(dep.dir); err != nil {
+				log.Printf("%s not found at revision %s", dep.ImportPath, dep.wantRev)
+				err1 = errorLoadingDeps
+				break
+			}
+		}
+		var err error
+		dep.Patches, err = loadPatches(dep.ImportPath)
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			break
+		}
+		if dep.vcs == nil {
+			dep.Archive = dep.archive
+			dep.Rev, dep.Comment, dep.Repo = "", "", ""
+			dep.Hash, err = hashSrc(*dep)
+			if err != nil {
+				log.Println(err)
+				err1 = errorLoadingDeps
+				continue
+			}
+			tocopy = append(tocopy, *dep)
+			continue
+		}
+		id, err := dep.vcs.identify(dep.dir)
 		if err != nil {
 			log.Println(err)
 			err1 = errorLoadingDeps
 			continue
 		}
-		if dep.vcs.isDirty(dep.pkg.Dir, id) {
-			log.Println("dirty working tree (please commit changes):", dep.pkg.Dir)
+		dep.Dirty, err = checkDirty(dep.vcs, dep.dir, id)
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			break
+		}
+		dep.Submodules, err = dep.vcs.submodules(dep.dir)
+		if err != nil {
+			log.Println(err)
 			err1 = errorLoadingDeps
 			break
 		}
+		if err := checkLFS(*dep); err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			break
+		}
+		dep.Archive = nil
 		dep.Rev = id
-		dep.Comment = dep.vcs.describe(dep.pkg.Dir, id)
+		dep.Comment = dep.vcs.describe(dep.dir, id)
+		dep.Repo = dep.vcs.forkURL(dep.pkg.Dir, dep.root)
+		dep.Hash, err = hashSrc(*dep)
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			continue
+		}
 		tocopy = append(tocopy, *dep)
 	}
 	if err1 != nil {
+		for _, ws := range checkouts {
+			os.RemoveAll(ws)
+		}
 		return nil, err1
 	}
 	return tocopy, nil
 }
+
+// checkoutRev clones the repository containing dep from GOPATH
+// into a new temporary workspace, checks out dep.wantRev there,
+// and returns the workspace. The revision is resolved in the
+// repository in GOPATH first, so it may also name a branch that
+// is only a remote branch there.
+func checkoutRev(dep Dependency) (string, error) {
+	ws, err := ioutil.TempDir("", "godep-update")
+	if err != nil {
+		return "", err
+	}
+	root := filepath.FromSlash(dep.root)
+	dir := filepath.Join(ws, "src", root)
+	err = os.MkdirAll(filepath.Dir(dir), 0777)
+	repo := filepath.Join(dep.pkg.Root, "src", root)
+	rev := dep.wantRev
+	if err == nil {
+		rev, err = dep.vcs.resolve(repo, rev)
+	}
+	if err == nil && dep.vcs == vcsSvn {
+		// A working copy cannot be checked out; use its repository.
+		repo, err = dep.vcs.remote(repo)
+	}
+	if err == nil {
+		err = dep.vcs.vcs.Create(dir, repo)
+	}
+	if err == nil {
+		err = dep.vcs.RevSync(dir, rev)
+	}
+	if err == nil && dep.vcs.SubmoduleSyncCmd != "" {
+		err = dep.vcs.run(dir, dep.vcs.SubmoduleSyncCmd)
+	}
+	if err != nil {
+		os.RemoveAll(ws)
+		return "", fmt.Errorf("cannot check out %s at revision %s: %v", dep.root, dep.wantRev, err)
+	}
+	return ws, nil
+}
+
+// removeCheckouts removes the temporary workspaces
+// created by LoadVCSAndUpdate for deps.
+func removeCheckouts(deps []Dependency) {
+	for _, dep := range deps {
+		if dep.wantRev != "" {
+			os.RemoveAll(dep.ws)
+		}
+	}
+}
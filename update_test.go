@@ -54,6 +54,88 @@ func TestUpdate(t *testing.T) {
 				},
 			},
 		},
+		{ // patch no longer applies, nothing is changed
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"x.go", "package D\n\nvar X = 1\n", nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"x.go", "package D\n\nvar X = 5\n", nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/patches/D/0001-x.patch", xPatch("1", "2"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+						{"Godeps/_workspace/src/D/x.go", "package D\n\nvar X = 2\n", nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+				{"C/Godeps/_workspace/src/D/x.go", "package D\n\nvar X = 2\n", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{ // second patch no longer applies, nothing is half-patched
+			cwd:  "C",
+			args: []string{"D"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"x.go", "package D\n\nvar X = 1\n", nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/patches/D/0001-x.patch", xPatch("1", "2"), nil},
+						{"Godeps/patches/D/0002-x.patch", xPatch("5", "6"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+						{"Godeps/_workspace/src/D/x.go", "package D\n\nvar X = 7\n", nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+				{"C/Godeps/_workspace/src/D/x.go", "package D\n\nvar X = 7\n", nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
 		{ // simple case, update one dependency, trailing slash
 			cwd:  "C",
 			args: []string{"D/"},
@@ -399,6 +481,138 @@ func TestUpdate(t *testing.T) {
 			},
 			werr: true,
 		},
+		{ // explicit revision, GOPATH is left alone
+			cwd:  "C",
+			args: []string{"D/...@D2"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("D1"), nil},
+						{"B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"A/main.go", pkg("A") + decl("D2"), nil},
+						{"B/main.go", pkg("B") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"A/main.go", pkg("A") + decl("D3"), nil},
+						{"B/main.go", pkg("B") + decl("D3"), nil},
+						{"+git", "D3", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D/A", "D/B"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D/A", "D1", "D/B", "D1"), nil},
+						{"Godeps/_workspace/src/D/A/main.go", pkg("A") + decl("D1"), nil},
+						{"Godeps/_workspace/src/D/B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/A/main.go", pkg("A") + decl("D2"), nil},
+				{"C/Godeps/_workspace/src/D/B/main.go", pkg("B") + decl("D2"), nil},
+				{"D/A/main.go", pkg("A") + decl("D3"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D/A", Comment: "D2"},
+					{ImportPath: "D/B", Comment: "D2"},
+				},
+			},
+		},
+		{ // explicit revision not found
+			cwd:  "C",
+			args: []string{"D/...@nosuchrev"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("D1"), nil},
+						{"B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"A/main.go", pkg("A") + decl("D2"), nil},
+						{"B/main.go", pkg("B") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"A/main.go", pkg("A") + decl("D3"), nil},
+						{"B/main.go", pkg("B") + decl("D3"), nil},
+						{"+git", "D3", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D/A", "D/B"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D/A", "D1", "D/B", "D1"), nil},
+						{"Godeps/_workspace/src/D/A/main.go", pkg("A") + decl("D1"), nil},
+						{"Godeps/_workspace/src/D/B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/A/main.go", pkg("A") + decl("D1"), nil},
+				{"C/Godeps/_workspace/src/D/B/main.go", pkg("B") + decl("D1"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D/A", Comment: "D1"},
+					{ImportPath: "D/B", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
+		{ // different revisions for one repo
+			cwd:  "C",
+			args: []string{"D/A@D2", "D/B@D3"},
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"A/main.go", pkg("A") + decl("D1"), nil},
+						{"B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"A/main.go", pkg("A") + decl("D2"), nil},
+						{"B/main.go", pkg("B") + decl("D2"), nil},
+						{"+git", "D2", nil},
+						{"A/main.go", pkg("A") + decl("D3"), nil},
+						{"B/main.go", pkg("B") + decl("D3"), nil},
+						{"+git", "D3", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D/A", "D/B"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D/A", "D1", "D/B", "D1"), nil},
+						{"Godeps/_workspace/src/D/A/main.go", pkg("A") + decl("D1"), nil},
+						{"Godeps/_workspace/src/D/B/main.go", pkg("B") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []*node{
+				{"C/Godeps/_workspace/src/D/A/main.go", pkg("A") + decl("D1"), nil},
+				{"C/Godeps/_workspace/src/D/B/main.go", pkg("B") + decl("D1"), nil},
+			},
+			wdep: Godeps{
+				ImportPath: "C",
+				Deps: []Dependency{
+					{ImportPath: "D/A", Comment: "D1"},
+					{ImportPath: "D/B", Comment: "D1"},
+				},
+			},
+			werr: true,
+		},
 	}
 
 	wd, err := os.Getwd()
@@ -453,9 +667,91 @@ func TestUpdate(t *testing.T) {
 		}
 		for i := range g.Deps {
 			g.Deps[i].Rev = ""
+			g.Deps[i].Hash = ""
 		}
 		if !reflect.DeepEqual(g.Deps, test.wdep.Deps) {
 			t.Errorf("Deps = %v want %v", g.Deps, test.wdep.Deps)
 		}
 	}
 }
+
+func TestUpdateRemoteBranch(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, rev := range []string{"dev", "origin/dev"} {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upstream := filepath.Join(wd, gopath, "upstream")
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{upstream, "", []*node{
+			{
+				"D",
+				"",
+				[]*node{
+					{"main.go", pkg("D") + decl("D1"), nil},
+					{"+git", "D1", nil},
+				},
+			},
+		}}, "")
+		// dev is a branch only upstream, so GOPATH has it as origin/dev
+		run(t, filepath.Join(upstream, "D"), "git", "checkout", "-q", "-b", "dev")
+		makeTree(t, &node{upstream, "", []*node{
+			{
+				"D",
+				"",
+				[]*node{
+					{"main.go", pkg("D") + decl("D2"), nil},
+					{"+git", "", nil},
+				},
+			},
+		}}, "")
+		run(t, filepath.Join(upstream, "D"), "git", "checkout", "-q", "-")
+		err = os.MkdirAll(src, 0770)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run(t, src, "git", "clone", "-q", "file://"+filepath.Join(upstream, "D"), "D")
+		makeTree(t, &node{src, "", []*node{
+			{
+				"C",
+				"",
+				[]*node{
+					{"main.go", pkg("main", "D"), nil},
+					{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+					{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+					{"+git", "", nil},
+				},
+			},
+		}}, "")
+
+		err = os.Chdir(filepath.Join(wd, src, "C"))
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		err = update([]string{"D@" + rev})
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			t.Errorf("%d update D@%s err = %v", pos, rev, err)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		checkTree(t, pos, &node{src, "", []*node{
+			{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+			{"D/main.go", pkg("D") + decl("D1"), nil},
+		}})
+	}
+}
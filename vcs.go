@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"os/exec"
@@ -19,10 +20,32 @@ type VCS struct {
 	DescribeCmd string
 	DiffCmd     string
 	ListCmd     string
+	LogCmd      string // prints commits after {old} up to {new}
 	RootCmd     string
+	ShowCmd     string // prints {file} as of revision {rev}
+	RemoteCmd   string // prints the URL of the default remote
+	SyncCmd     string // checks out {rev}; if empty, the tag sync command is used
+	ResolveCmd  string // prints the full ID of commit {rev}; if empty, revisions are used as given
+
+	// used for nested repositories
+	SubmoduleListCmd string // prints the status of nested repositories, as git submodule status
+	SubmoduleSyncCmd string // checks out nested repositories at their recorded revisions
+	LFSFetchCmd      string // fetches the large file content of {files}, comma-separated
 
 	// run in sandbox repos
 	ExistsCmd string
+	HeadCmd   string // prints the latest commit of the default branch
+
+	// used by outdated; if UpstreamHeadCmd is empty, outdated
+	// clones the upstream repository instead
+	UpstreamFetchCmd string // fetches new commits and tags from the default remote, leaving the checkout alone
+	UpstreamHeadCmd  string // prints the latest commit of the default branch of the default remote
+
+	// used by the repository cache
+	MirrorCmd    string // creates a bare mirror of {repo} in {dir}
+	FetchCmd     string // updates a mirror from its remote
+	VerifyCmd    string // checks the integrity of a mirror
+	SetRemoteCmd string // sets the default remote to {url}
 }
 
 var vcsBzr = &VCS{
@@ -32,7 +55,17 @@ var vcsBzr = &VCS{
 	DescribeCmd: "revno", // TODO(kr): find tag names if possible
 	DiffCmd:     "diff -r {rev}",
 	ListCmd:     "ls --from-root -R",
+	LogCmd:      "log --line --exclude-common-ancestry -r revid:{old}..revid:{new}",
 	RootCmd:     "root",
+	ShowCmd:     "cat -r {rev} {file}",
+	RemoteCmd:   "config parent_location",
+
+	HeadCmd: "version-info --custom --template {revision_id}",
+
+	MirrorCmd:    "branch --no-tree {repo} {dir}",
+	FetchCmd:     "pull --overwrite",
+	VerifyCmd:    "check",
+	SetRemoteCmd: "config parent_location={url}",
 }
 
 var vcsGit = &VCS{
@@ -41,10 +74,27 @@ var vcsGit = &VCS{
 	IdentifyCmd: "rev-parse HEAD",
 	DescribeCmd: "describe --tags",
 	DiffCmd:     "diff {rev}",
-	ListCmd:     "ls-files --full-name",
+	ListCmd:     "ls-files --full-name --recurse-submodules",
+	LogCmd:      "log --oneline {old}..{new}",
 	RootCmd:     "rev-parse --show-toplevel",
+	ShowCmd:     "show {rev}:./{file}",
+	RemoteCmd:   "config remote.origin.url",
+	ResolveCmd:  "rev-parse --verify {rev}^{commit}",
+
+	SubmoduleListCmd: "submodule status --recursive",
+	SubmoduleSyncCmd: "submodule update --init --recursive",
+	LFSFetchCmd:      "lfs pull --include {files}",
 
 	ExistsCmd: "cat-file -e {rev}",
+	HeadCmd:   "rev-parse HEAD",
+
+	UpstreamFetchCmd: "fetch --tags origin",
+	UpstreamHeadCmd:  "rev-parse refs/remotes/origin/HEAD",
+
+	MirrorCmd:    "clone --mirror {repo} {dir}",
+	FetchCmd:     "remote update --prune",
+	VerifyCmd:    "fsck",
+	SetRemoteCmd: "remote set-url origin {url}",
 }
 
 var vcsHg = &VCS{
@@ -54,20 +104,59 @@ var vcsHg = &VCS{
 	DescribeCmd: "log -r . --template {latesttag}-{latesttagdistance}",
 	DiffCmd:     "diff -r {rev}",
 	ListCmd:     "status --all --no-status",
+	LogCmd:      `log -r {new}%{old} --template {node|short}\x20{desc|firstline}\n`,
 	RootCmd:     "root",
+	ShowCmd:     "cat -r {rev} {file}",
+	RemoteCmd:   "paths default",
 
 	ExistsCmd: "cat -r {rev} .",
+	HeadCmd:   "log -r default --template {node}",
+
+	UpstreamFetchCmd: "pull", // without -u, so the working directory is left alone
+	UpstreamHeadCmd:  "log -r default --template {node}",
+
+	MirrorCmd: "clone -U {repo} {dir}",
+	FetchCmd:  "pull",
+	VerifyCmd: "verify",
+	// SetRemoteCmd is handled by hgLink.
+}
+
+// Subversion has no local history, so most commands
+// read the repository of the working copy.
+var vcsSvn = &VCS{
+	vcs: vcs.ByCmd("svn"),
+
+	IdentifyCmd: "info --show-item revision",
+	DescribeCmd: "info --show-item relative-url", // branch or tag
+	DiffCmd:     "diff -r {rev}",
+	ListCmd:     "list -R {root}",
+	LogCmd:      "log -r {new}:{old}", // includes {old}
+	RootCmd:     "info --show-item wc-root",
+	ShowCmd:     "cat -r {rev} {file}",
+	RemoteCmd:   "info --show-item url",
+	SyncCmd:     "update -r {rev}",
+
+	ExistsCmd: "info -r {rev}",
+	HeadCmd:   "info -r HEAD --show-item revision",
+
+	UpstreamHeadCmd: "info -r HEAD --show-item revision",
+
+	// Subversion has no local mirrors; the cache is not used.
 }
 
 var cmd = map[*vcs.Cmd]*VCS{
 	vcsBzr.vcs: vcsBzr,
 	vcsGit.vcs: vcsGit,
 	vcsHg.vcs:  vcsHg,
+	vcsSvn.vcs: vcsSvn,
 }
 
 // VCSFromDir returns a VCS value from a directory.
 func VCSFromDir(dir, srcRoot string) (*VCS, string, error) {
 	vcscmd, reporoot, err := vcs.FromDir(dir, srcRoot)
+	if v, root, ok := fromDirMarkers(dir, srcRoot); ok && (err != nil || len(root) > len(reporoot)) {
+		return v, root, nil
+	}
 	if err != nil {
 		return nil, "", fmt.Errorf("error while inspecting %q: %v", dir, err)
 	}
@@ -80,7 +169,7 @@ func VCSFromDir(dir, srcRoot string) (*VCS, string, error) {
 
 // VCSForImportPath returns a VCS value for an import path.
 func VCSForImportPath(importPath string) (*VCS, error) {
-	rr, err := vcs.RepoRootForImportPath(importPath, verbose)
+	rr, err := repoRootForImportPath(importPath)
 	if err != nil {
 		return nil, err
 	}
@@ -109,14 +198,164 @@ func (v *VCS) describe(dir, rev string) string {
 	return string(bytes.TrimSpace(out))
 }
 
-func (v *VCS) isDirty(dir, rev string) bool {
+// dirtyHash returns a hash of the uncommitted changes in the
+// working tree in dir, relative to revision rev, or "" if
+// there are none.
+func (v *VCS) dirtyHash(dir, rev string) (string, error) {
 	out, err := v.runOutput(dir, v.DiffCmd, "rev", rev)
-	return err != nil || len(out) != 0
+	if err != nil {
+		return "", err
+	}
+	if len(out) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(out)), nil
+}
+
+// log returns the commits in dir after revision old
+// up to and including revision new, one per line.
+func (v *VCS) log(dir, old, new string) (string, error) {
+	out, err := v.runOutput(dir, v.LogCmd, "old", old, "new", new)
+	return string(out), err
+}
+
+// remote returns the URL of the default remote
+// of the repository containing dir.
+func (v *VCS) remote(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.RemoteCmd)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// forkURL returns the URL of the default remote of the repository
+// in dir if it is not the usual repository for the import path
+// root, as for a fork. Otherwise, or if there is no remote, it
+// returns "". The usual repository is found without network
+// access, from the well-known sites and the configured mirrors;
+// if it can't be found that way, forkURL returns "".
+func (v *VCS) forkURL(dir, root string) string {
+	out, err := v.runOutputVerboseOnly(dir, v.RemoteCmd)
+	remote := string(bytes.TrimSpace(out))
+	if err != nil || remote == "" {
+		return ""
+	}
+	if strings.EqualFold(repoPath(remote), root) {
+		return ""
+	}
+	var repos []string
+	if rr, err := vcs.RepoRootForImportPathStatic(root, "https"); err == nil {
+		repos = append(repos, rr.Repo)
+	}
+	if c, err := loadConfig(); err == nil && c.mirror(root) != nil {
+		// With a mirror, repoRootForImportPath does no lookups.
+		if rr, err := repoRootForImportPath(root); err == nil {
+			repos = append(repos, rr.Repo)
+		}
+	}
+	if len(repos) == 0 {
+		return "" // can't tell offline
+	}
+	for _, repo := range repos {
+		if strings.EqualFold(repoPath(remote), repoPath(repo)) {
+			return ""
+		}
+	}
+	return remote
+}
+
+// repoPath returns the host and path of the repository URL s,
+// without scheme, user name or VCS suffix, for comparison.
+// For example, git@github.com:a/b.git becomes github.com/a/b.
+func repoPath(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+len("://"):]
+	} else if i := strings.Index(s, ":"); i >= 0 && !strings.Contains(s[:i], "/") {
+		s = s[:i] + "/" + s[i+1:] // scp-like syntax
+	}
+	if i := strings.Index(s, "@"); i >= 0 && !strings.Contains(s[:i], "/") {
+		s = s[i+1:]
+	}
+	s = strings.TrimSuffix(s, "/")
+	for _, suffix := range []string{".git", ".hg", ".bzr"} {
+		s = strings.TrimSuffix(s, suffix)
+	}
+	return s
 }
 
+// head returns the latest commit of the default branch
+// of the repository in dir.
+func (v *VCS) head(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.HeadCmd)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// upstreamHead returns the latest commit of the default branch
+// of the default remote of the repository in dir, as of the last
+// UpstreamFetchCmd.
+func (v *VCS) upstreamHead(dir string) (string, error) {
+	out, err := v.runOutput(dir, v.UpstreamHeadCmd)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// setRemote sets the default remote of the repository in dir to url.
+func (v *VCS) setRemote(dir, url string) error {
+	if v == vcsHg {
+		return hgLink(dir, "default", url)
+	}
+	return v.run(dir, v.SetRemoteCmd, "url", url)
+}
+
+// submodules returns the submodules in dir, at any depth, with
+// paths relative to dir. It returns an error if a submodule is
+// not checked out at the revision recorded in its parent.
+func (v *VCS) submodules(dir string) ([]Submodule, error) {
+	if v.SubmoduleListCmd == "" {
+		return nil, nil
+	}
+	root, err := v.root(dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := v.runOutput(root, v.SubmoduleListCmd)
+	if err != nil {
+		return nil, err
+	}
+	var a []Submodule
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(line) == 0 || len(f) < 2 {
+			continue
+		}
+		path, err := filepath.Rel(dir, filepath.Join(root, f[1]))
+		if err != nil || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			continue // not in dir
+		}
+		switch line[0] {
+		case '-':
+			return nil, fmt.Errorf("submodule %s is not checked out (run 'git submodule update --init --recursive')", filepath.Join(root, f[1]))
+		case '+', 'U':
+			return nil, fmt.Errorf("submodule %s is not at the revision recorded in its parent", filepath.Join(root, f[1]))
+		}
+		a = append(a, Submodule{Path: filepath.ToSlash(path), Rev: strings.TrimLeft(f[0], "+-U")})
+	}
+	return a, nil
+}
+
+// show returns the contents of file, relative to dir,
+// as of revision rev.
+func (v *VCS) show(dir, file, rev string) ([]byte, error) {
+	return v.runOutput(dir, v.ShowCmd, "file", filepath.ToSlash(file), "rev", rev)
+}
+
+// vcsFiles is a set of files tracked by a VCS.
+// A nil vcsFiles, for a directory not under version
+// control, contains all files.
 type vcsFiles map[string]bool
 
 func (vf vcsFiles) Contains(path string) bool {
+	if vf == nil {
+		return true
+	}
+
 	// Fast path, we have the path
 	if vf[path] {
 		return true
@@ -135,14 +374,18 @@ func (vf vcsFiles) Contains(path string) bool {
 }
 
 // listFiles tracked by the VCS in the repo that contains dir, converted to absolute path.
+// If v is nil, as for an archive, it returns nil, which contains all files.
 func (v *VCS) listFiles(dir string) vcsFiles {
+	if v == nil {
+		return nil
+	}
 	root, err := v.root(dir)
 	if err != nil {
-		return nil
+		return vcsFiles{}
 	}
-	out, err := v.runOutput(dir, v.ListCmd)
+	out, err := v.runOutput(dir, v.ListCmd, "root", root)
 	if err != nil {
-		return nil
+		return vcsFiles{}
 	}
 	files := make(vcsFiles)
 	for _, file := range bytes.Split(out, []byte{'\n'}) {
@@ -162,9 +405,30 @@ func (v *VCS) exists(dir, rev string) bool {
 	return err == nil
 }
 
+// resolve returns the full ID of the commit rev, a tag, branch
+// or commit, in the repository in dir. A rev not found there is
+// tried as a branch of the default remote, origin/rev, since a
+// clone has only its local branches.
+func (v *VCS) resolve(dir, rev string) (string, error) {
+	if v.ResolveCmd == "" {
+		return rev, nil
+	}
+	out, err := v.runOutputVerboseOnly(dir, v.ResolveCmd, "rev", rev)
+	if err != nil {
+		out, err = v.runOutputVerboseOnly(dir, v.ResolveCmd, "rev", "origin/"+rev)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %s", rev)
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
 // RevSync checks out the revision given by rev in dir.
 // The dir must exist and rev must be a valid revision.
 func (v *VCS) RevSync(dir, rev string) error {
+	if v.SyncCmd != "" {
+		return v.run(dir, v.SyncCmd, "rev", rev)
+	}
 	return v.run(dir, v.vcs.TagSyncCmd, "tag", rev)
 }
 
@@ -198,6 +462,9 @@ func (v *VCS) runOutputVerboseOnly(dir string, cmdline string, kv ...string) ([]
 
 // run1 is the generalized implementation of run and runOutput.
 func (v *VCS) run1(dir string, cmdline string, kv []string, verbose bool) ([]byte, error) {
+	if cmdline == "" {
+		return nil, fmt.Errorf("not supported by %s", v.vcs.Name)
+	}
 	m := make(map[string]string)
 	for i := 0; i < len(kv); i += 2 {
 		m[kv[i]] = kv[i+1]
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tools/godep/Godeps/_workspace/src/golang.org/x/tools/go/vcs"
+)
+
+func TestRepoPath(t *testing.T) {
+	var cases = []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/a/b", "github.com/a/b"},
+		{"https://github.com/a/b.git", "github.com/a/b"},
+		{"https://user@github.com/a/b/", "github.com/a/b"},
+		{"git@github.com:a/b.git", "github.com/a/b"},
+		{"ssh://git@github.com/a/b", "github.com/a/b"},
+		{"file:///src/a/b", "/src/a/b"},
+		{"/src/a/b", "/src/a/b"},
+	}
+	for _, test := range cases {
+		if g := repoPath(test.url); g != test.want {
+			t.Errorf("repoPath(%q) = %q want %q", test.url, g, test.want)
+		}
+	}
+}
+
+func TestForkURL(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(wd, gopath, "src", "github.com", "a", "D")
+	makeTree(t, &node{dir, "", []*node{
+		{"main.go", pkg("D"), nil},
+		{"+git", "", nil},
+	}}, "")
+	v := cmd[vcs.ByCmd("git")]
+	if g := v.forkURL(dir, "github.com/a/D"); g != "" {
+		t.Errorf("forkURL without remote = %q want none", g)
+	}
+
+	var cases = []struct {
+		remote string
+		want   string
+	}{
+		{"https://github.com/a/D", ""},
+		{"git@github.com:a/D.git", ""},
+		{"https://github.com/us/D", "https://github.com/us/D"},
+		{"file:///src/a/D", "file:///src/a/D"},
+	}
+	run(t, dir, "git", "remote", "add", "origin", "https://github.com/a/D")
+	for _, test := range cases {
+		run(t, dir, "git", "remote", "set-url", "origin", test.remote)
+		if g := v.forkURL(dir, "github.com/a/D"); g != test.want {
+			t.Errorf("forkURL with remote %s = %q want %q", test.remote, g, test.want)
+		}
+	}
+
+	// Sites that need a lookup are not looked up.
+	run(t, dir, "git", "remote", "set-url", "origin", "https://git.example.com/D")
+	if g := v.forkURL(dir, "example.com/a/D"); g != "" {
+		t.Errorf("forkURL for unknown site = %q want none", g)
+	}
+
+	// Mirrors are the usual repository too.
+	defer setConfig(t, filepath.Join(wd, gopath), &Config{Mirrors: []Mirror{
+		{Prefix: "github.com/", URL: "https://git.example.com/mirror/"},
+		{Prefix: "example.com/a/D", URL: "https://git.example.com/D"},
+	}})()
+	cases = []struct {
+		remote string
+		want   string
+	}{
+		{"https://git.example.com/mirror/a/D", ""},
+		{"https://github.com/a/D", ""},
+		{"https://github.com/us/D", "https://github.com/us/D"},
+	}
+	for _, test := range cases {
+		run(t, dir, "git", "remote", "set-url", "origin", test.remote)
+		if g := v.forkURL(dir, "github.com/a/D"); g != test.want {
+			t.Errorf("forkURL with mirror and remote %s = %q want %q", test.remote, g, test.want)
+		}
+	}
+	run(t, dir, "git", "remote", "set-url", "origin", "https://git.example.com/D")
+	if g := v.forkURL(dir, "example.com/a/D"); g != "" {
+		t.Errorf("forkURL for mirrored site = %q want none", g)
+	}
+}
+
+func TestSvn(t *testing.T) {
+	for _, name := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s not found", name)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(wd, gopath, "src")
+	err = os.MkdirAll(src, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(wd, gopath, "repo")
+	run(t, filepath.Join(wd, gopath), "svnadmin", "create", repo)
+	run(t, src, "svn", "checkout", "-q", "file://"+repo, "D")
+	dir := filepath.Join(src, "D")
+	commit := func(body string) string {
+		makeTree(t, &node{dir, "", []*node{{"main.go", body, nil}}}, "")
+		run(t, dir, "svn", "add", "-q", "--force", ".")
+		run(t, dir, "svn", "commit", "-q", "-m", "godep")
+		run(t, dir, "svn", "update", "-q")
+		return strings.TrimSpace(run(t, dir, "svn", "info", "--show-item", "revision"))
+	}
+	rev1 := commit(pkg("D") + decl("D1"))
+	rev2 := commit(pkg("D") + decl("D2"))
+	makeTree(t, &node{src, "", []*node{
+		{"C/main.go", pkg("main", "D"), nil},
+	}}, "")
+
+	err = os.Chdir(filepath.Join(src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	err = save(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Deps) != 1 || g.Deps[0].ImportPath != "D" || g.Deps[0].Rev != rev2 {
+		t.Fatalf("saved deps = %+v want D at %s", g.Deps, rev2)
+	}
+	checkTree(t, 0, &node{src, "", []*node{
+		{"C/Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+	}})
+
+	g.Deps[0].Rev = rev1
+	g.Deps[0].Hash = ""
+	log.SetOutput(ioutil.Discard)
+	err = restoreDeps(g.Deps, 1)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 1, &node{src, "", []*node{
+		{"D/main.go", pkg("D") + decl("D1"), nil},
+	}})
+}
+
+func TestSubmodules(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	err = os.RemoveAll(gopath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Allow git to use submodules from file URLs.
+	for k, v := range map[string]string{
+		"GIT_CONFIG_COUNT":   "1",
+		"GIT_CONFIG_KEY_0":   "protocol.file.allow",
+		"GIT_CONFIG_VALUE_0": "always",
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+	upstream := filepath.Join(wd, gopath, "upstream")
+	src := filepath.Join(gopath, "src")
+	makeTree(t, &node{upstream, "", []*node{
+		{
+			"S",
+			"",
+			[]*node{
+				{"s.go", pkg("sub") + decl("S1"), nil},
+				{"+git", "S1", nil},
+				{"s.go", pkg("sub") + decl("S2"), nil},
+				{"+git", "S2", nil},
+			},
+		},
+	}}, "")
+	makeTree(t, &node{src, "", []*node{
+		{
+			"D",
+			"",
+			[]*node{
+				{"main.go", pkg("D", "D/sub"), nil},
+				{"+git", "", nil},
+			},
+		},
+		{"C/main.go", pkg("main", "D"), nil},
+	}}, "")
+	dir := filepath.Join(src, "D")
+	run(t, dir, "git", "submodule", "add", "-q", "file://"+filepath.Join(upstream, "S"), "sub")
+	run(t, filepath.Join(dir, "sub"), "git", "checkout", "-q", "S1")
+	run(t, dir, "git", "commit", "-q", "-am", "add sub")
+	rev := func(dir, tag string) string {
+		return strings.TrimSpace(run(t, dir, "git", "rev-parse", tag))
+	}
+	s1 := rev(filepath.Join(upstream, "S"), "S1")
+	d1 := rev(dir, "HEAD")
+
+	err = os.Chdir(filepath.Join(src, "C"))
+	if err != nil {
+		panic(err)
+	}
+	defer os.Chdir(wd)
+	err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+	if err != nil {
+		panic(err)
+	}
+	err = save(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Submodule{{Path: "sub", Rev: s1}}
+	if len(g.Deps) != 1 || g.Deps[0].Rev != d1 || !reflect.DeepEqual(g.Deps[0].Submodules, want) {
+		t.Fatalf("saved deps = %+v want D at %s with submodules %v", g.Deps, d1, want)
+	}
+	checkTree(t, 0, &node{filepath.Join(wd, src), "", []*node{
+		{"C/Godeps/_workspace/src/D/main.go", pkg("D", "D/sub"), nil},
+		{"C/Godeps/_workspace/src/D/sub/s.go", pkg("sub") + decl("S1"), nil},
+	}})
+
+	// Move the submodule on, then restore the saved revisions.
+	run(t, filepath.Join(wd, dir, "sub"), "git", "checkout", "-q", "S2")
+	run(t, filepath.Join(wd, dir), "git", "commit", "-q", "-am", "update sub")
+	log.SetOutput(ioutil.Discard)
+	err = restoreDeps(g.Deps, 1)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, 1, &node{filepath.Join(wd, src), "", []*node{
+		{"D/sub/s.go", pkg("sub") + decl("S1"), nil},
+	}})
+}
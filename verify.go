@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tools/godep/Godeps/_workspace/src/github.com/kr/fs"
+)
+
+var cmdVerify = &Command{
+	Usage: "verify [-t] [-v]",
+	Short: "check copied source code against the saved dependencies",
+	Long: `
+Verify compares the source code copied into Godeps/_workspace (or
+vendor/, if the vendor experiment is turned on) with the source code
+'godep save' would copy for the revision of each dependency listed in
+Godeps/Godeps.json.
+
+The listed revision of each dependency must be checked out in GOPATH.
+Run 'godep restore' first if necessary. A dependency saved with
+uncommitted changes must have the same changes in GOPATH. The source
+of a dependency with Patches is compared after applying them.
+
+Files that were added, removed or modified in the copy are listed
+for each dependency. Go files with import paths rewritten by
+'godep save -r' are compared as if the paths were not rewritten.
+Verify exits with a non-zero status if there are any such files,
+or if a dependency could not be checked.
+
+If -t is given, test files (*_test.go files + testdata directories) are
+expected in the copy, as with 'godep save -t'.
+
+If -v is given, verbose output is enabled.
+`,
+	Run: runVerify,
+}
+
+func init() {
+	cmdVerify.Flag.BoolVar(&saveT, "t", false, "expect test files")
+	cmdVerify.Flag.BoolVar(&verbose, "v", false, "enable verbose output")
+}
+
+func runVerify(cmd *Command, args []string) {
+	if len(args) != 0 {
+		cmd.UsageExit()
+	}
+	g, err := loadDefaultGodepsFile()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	drifts, err := verify(g.Deps, relativeVendorTarget(VendorExperiment))
+	for _, d := range drifts {
+		name := d.ImportPath
+		if name == "" {
+			name = "(not in " + g.file() + ")"
+		}
+		fmt.Println(name)
+		for _, f := range d.Added {
+			fmt.Println("\tadded:   ", f)
+		}
+		for _, f := range d.Removed {
+			fmt.Println("\tremoved: ", f)
+		}
+		for _, f := range d.Modified {
+			fmt.Println("\tmodified:", f)
+		}
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(drifts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// A drift lists the files in the copied source of a dependency
+// that differ from the files save would copy.
+// File names are slash-separated and relative to the root of
+// the copied source tree.
+type drift struct {
+	ImportPath string // empty for files that belong to no dependency
+	Added      []string
+	Removed    []string
+	Modified   []string
+}
+
+func (d *drift) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// verify compares the copied source of deps in srcdir with the
+// source of each dependency at its revision in GOPATH.
+// Dependencies that are missing from GOPATH or not at the right
+// revision there are logged and skipped.
+func verify(deps []Dependency, srcdir string) ([]drift, error) {
+	var err1 error
+	if err := loadDeps(deps); err != nil {
+		if err != errorLoadingDeps {
+			return nil, err
+		}
+		err1 = err
+	}
+	skip := make(map[int]bool)
+	for i, dep := range deps {
+		if dep.vcs == nil && dep.archive == nil {
+			skip[i] = true // not in GOPATH; logged by loadDeps
+			continue
+		}
+		if dep.vcs == nil {
+			if dep.Archive == nil || *dep.Archive != *dep.archive {
+				log.Printf("%s is from archive %s in GOPATH, want %v (run 'godep restore')", dep.ImportPath, dep.archive.URL, dep.Archive)
+				err1 = errorLoadingDeps
+				skip[i] = true
+			}
+			continue
+		}
+		id, err := dep.vcs.identify(dep.dir)
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			skip[i] = true
+			continue
+		}
+		if id != dep.Rev {
+			log.Printf("%s is at revision %s in GOPATH, want %s (run 'godep restore')", dep.ImportPath, id, dep.Rev)
+			err1 = errorLoadingDeps
+			skip[i] = true
+			continue
+		}
+		dirty, err := dep.vcs.dirtyHash(dep.dir, id)
+		if err != nil {
+			log.Println(err)
+			err1 = errorLoadingDeps
+			skip[i] = true
+			continue
+		}
+		if dirty != dep.Dirty {
+			if dep.Dirty == "" {
+				log.Println("dirty working tree (please commit changes):", dep.dir)
+			} else {
+				log.Printf("%s: uncommitted changes in %s are not those saved in Godeps", dep.ImportPath, dep.dir)
+			}
+			err1 = errorLoadingDeps
+			skip[i] = true
+		}
+	}
+
+	// Collect the files save would copy, by dependency.
+	want := make(map[string]string) // copied name -> source file
+	owner := make(map[string]int)   // copied name -> index in deps
+	visited := make(map[string]bool)
+	for i, dep := range deps {
+		if skip[i] {
+			continue
+		}
+		i := i
+		if len(dep.Patches) > 0 {
+			// Compare with the patched source.
+			tmp, err := patchedCopy(dep)
+			if err != nil {
+				log.Println(err)
+				err1 = errorCopyingSourceCode
+				skip[i] = true
+				continue
+			}
+			defer os.RemoveAll(tmp)
+			w := fs.Walk(tmp)
+			for w.Step() {
+				if w.Err() != nil || w.Stat().IsDir() {
+					continue
+				}
+				rel, err := filepath.Rel(tmp, w.Path())
+				if err != nil { // this should never happen
+					return nil, err
+				}
+				rel = filepath.ToSlash(rel)
+				if _, ok := want[rel]; !ok {
+					want[rel] = w.Path()
+					owner[rel] = i
+				}
+			}
+			continue
+		}
+		if !walkSrc(dep, visited, func(rel, path string) error {
+			rel = filepath.ToSlash(rel)
+			if _, ok := want[rel]; !ok {
+				want[rel] = path
+				owner[rel] = i
+			}
+			return nil
+		}) {
+			err1 = errorCopyingSourceCode
+		}
+	}
+
+	drifts := make([]drift, len(deps)+1) // last one holds unowned files
+	for i, dep := range deps {
+		drifts[i].ImportPath = dep.ImportPath
+	}
+	have := make(map[string]bool)
+	w := fs.Walk(srcdir)
+	for w.Step() {
+		if w.Err() != nil {
+			log.Println(w.Err())
+			err1 = errorCopyingSourceCode
+			continue
+		}
+		if w.Stat().IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(srcdir, w.Path())
+		if err != nil { // this should never happen
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		have[rel] = true
+		src, ok := want[rel]
+		if !ok {
+			if i := ownerOf(rel, deps); !skip[i] {
+				drifts[i].Added = append(drifts[i].Added, rel)
+			}
+			continue
+		}
+		same, err := sameContents(w.Path(), src)
+		if err != nil {
+			log.Println(err)
+			err1 = errorCopyingSourceCode
+			continue
+		}
+		if !same {
+			i := owner[rel]
+			drifts[i].Modified = append(drifts[i].Modified, rel)
+		}
+	}
+	for rel := range want {
+		if !have[rel] {
+			i := owner[rel]
+			drifts[i].Removed = append(drifts[i].Removed, rel)
+		}
+	}
+
+	var a []drift
+	for _, d := range drifts {
+		if !d.empty() {
+			sort.Strings(d.Added)
+			sort.Strings(d.Removed)
+			sort.Strings(d.Modified)
+			a = append(a, d)
+		}
+	}
+	return a, err1
+}
+
+// ownerOf returns the index of the dependency in deps that the
+// copied file name most likely belongs to, or len(deps) if there
+// is none. It prefers the longest matching import path, then the
+// longest matching repo root.
+func ownerOf(name string, deps []Dependency) int {
+	best, n := len(deps), 0
+	for i, dep := range deps {
+		if strings.HasPrefix(name, dep.ImportPath+"/") && len(dep.ImportPath) > n {
+			best, n = i, len(dep.ImportPath)
+		}
+	}
+	if best < len(deps) {
+		return best
+	}
+	for i, dep := range deps {
+		if dep.root != "" && strings.HasPrefix(name, dep.root+"/") && len(dep.root) > n {
+			best, n = i, len(dep.root)
+		}
+	}
+	return best
+}
+
+// sameContents reports whether the copied file dst has the
+// contents copyFile would give it when copied from src. Go files
+// whose import paths were rewritten by save -r are compared with
+// the import paths unqualified.
+func sameContents(dst, src string) (bool, error) {
+	if linkSrc, err := os.Readlink(src); err == nil {
+		linkDst, err := os.Readlink(dst)
+		return err == nil && linkDst == linkSrc, nil
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	var want bytes.Buffer
+	if err := copyContents(&want, r, src); err != nil {
+		return false, err
+	}
+	have, err := ioutil.ReadFile(dst)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(have, want.Bytes()) {
+		return true, nil
+	}
+	if !strings.HasSuffix(dst, ".go") || !bytes.Contains(have, []byte(sep)) {
+		return false, nil
+	}
+	have, err = unqualifyImports(dst, have)
+	if err != nil {
+		return false, nil
+	}
+	b, err := unqualifyImports(src, want.Bytes())
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(have, b), nil
+}
+
+// unqualifyImports returns the Go source b with its import paths
+// unqualified, printed and sorted as rewriteGoFile would do it.
+func unqualifyImports(name string, b []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, b, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range f.Imports {
+		path, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			return nil, err // can't happen
+		}
+		s.Path.Value = strconv.Quote(unqualify(path))
+	}
+	var buf bytes.Buffer
+	printerConfig := &printer.Config{Mode: printer.TabIndent | printer.UseSpaces, Tabwidth: 8}
+	if err := printerConfig.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	fset = token.NewFileSet()
+	f, err = parser.ParseFile(fset, name, buf.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	ast.SortImports(fset, f)
+	buf.Reset()
+	if err := printerConfig.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
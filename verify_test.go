@@ -0,0 +1,251 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	var cases = []struct {
+		cwd   string
+		start []*node
+		want  []drift
+		werr  bool
+	}{
+		{ // unchanged copy
+			cwd: "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+		},
+		{ // import comment stripped in copy
+			cwd: "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", "package D // import \"D\"\n", nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", "package D\n", nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+		},
+		{ // modified, added and removed files
+			cwd: "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"util.go", pkg("D"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+						{"Godeps/_workspace/src/D/extra.go", pkg("D"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []drift{
+				{
+					ImportPath: "D",
+					Added:      []string{"D/extra.go"},
+					Removed:    []string{"D/util.go"},
+					Modified:   []string{"D/main.go"},
+				},
+				{
+					Added: []string{"E/main.go"},
+				},
+			},
+		},
+		{ // import paths rewritten by save -r
+			cwd: "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D", "E") + decl("D1"), nil},
+						{"util.go", pkg("D", "E") + decl("D2"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "C/Godeps/_workspace/src/D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D", "C/Godeps/_workspace/src/E") + decl("D1"), nil},
+						{"Godeps/_workspace/src/D/util.go", pkg("D", "C/Godeps/_workspace/src/E") + decl("D3"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []drift{
+				{
+					ImportPath: "D",
+					Modified:   []string{"D/util.go"},
+				},
+			},
+		},
+		{ // package missing from GOPATH, others still checked
+			cwd: "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+					},
+				},
+				{
+					"E",
+					"",
+					[]*node{
+						{"README", "no Go files here", nil},
+						{"+git", "E1", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D", "E"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1", "E", "E1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+						{"Godeps/_workspace/src/E/main.go", pkg("E") + decl("E1"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			want: []drift{
+				{
+					ImportPath: "D",
+					Modified:   []string{"D/main.go"},
+				},
+			},
+			werr: true,
+		},
+		{ // wrong revision in GOPATH
+			cwd: "C",
+			start: []*node{
+				{
+					"D",
+					"",
+					[]*node{
+						{"main.go", pkg("D") + decl("D1"), nil},
+						{"+git", "D1", nil},
+						{"main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "D2", nil},
+					},
+				},
+				{
+					"C",
+					"",
+					[]*node{
+						{"main.go", pkg("main", "D"), nil},
+						{"Godeps/Godeps.json", godeps("C", "D", "D1"), nil},
+						{"Godeps/_workspace/src/D/main.go", pkg("D") + decl("D2"), nil},
+						{"+git", "", nil},
+					},
+				},
+			},
+			werr: true,
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const gopath = "godeptest"
+	defer os.RemoveAll(gopath)
+	for pos, test := range cases {
+		err = os.RemoveAll(gopath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := filepath.Join(gopath, "src")
+		makeTree(t, &node{src, "", test.start}, "")
+
+		dir := filepath.Join(wd, src, test.cwd)
+		err = os.Chdir(dir)
+		if err != nil {
+			panic(err)
+		}
+		err = os.Setenv("GOPATH", filepath.Join(wd, gopath))
+		if err != nil {
+			panic(err)
+		}
+		g, err := loadDefaultGodepsFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.SetOutput(ioutil.Discard)
+		drifts, err := verify(g.Deps, filepath.Join("Godeps", "_workspace", "src"))
+		log.SetOutput(os.Stderr)
+		if g := err != nil; g != test.werr {
+			t.Errorf("%d verify err = %v (%v) want %v", pos, g, err, test.werr)
+		}
+		err = os.Chdir(wd)
+		if err != nil {
+			panic(err)
+		}
+
+		if !reflect.DeepEqual(drifts, test.want) {
+			t.Errorf("%d drifts = %+v want %+v", pos, drifts, test.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+)
+
+var cmdWhy = &Command{
+	Usage: "why [-a] importpath",
+	Short: "explain why a package is a dependency",
+	Long: `
+Why prints the shortest chain of imports from the packages saved
+in Godeps (or ".", if there are none) to the named package or any
+package inside it.
+
+Each package in the chain is printed on its own line, starting with
+one of the saved packages. Packages imported only by test files are
+marked with "(test)". A chain of build imports is printed if there
+is one, so a chain containing such a mark means the package is
+needed only for testing.
+
+If -a is given, all chains are printed, separated by blank lines.
+`,
+	Run: runWhy,
+}
+
+var whyAll bool
+
+func init() {
+	cmdWhy.Flag.BoolVar(&whyAll, "a", false, "print all import chains")
+}
+
+func runWhy(cmd *Command, args []string) {
+	if len(args) != 1 {
+		cmd.UsageExit()
+	}
+	target := path.Clean(args[0])
+	pkgs, err := LoadPackages(savedPackages(nil)...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	g, err := loadGraph(pkgs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var roots []string
+	for _, p := range pkgs {
+		if !p.Standard && p.Error.Err == "" {
+			roots = append(roots, unqualify(p.ImportPath))
+		}
+	}
+	match := func(s string) bool {
+		return containsPathPrefix([]string{target}, s)
+	}
+	var chains [][]edge
+	if whyAll {
+		chains = g.allChains(roots, match)
+	} else if c := g.shortestChain(roots, match); c != nil {
+		chains = append(chains, c)
+	}
+	if len(chains) == 0 {
+		log.Fatalf("no import chain to %s found", target)
+	}
+	for i, c := range chains {
+		if i > 0 {
+			fmt.Println()
+		}
+		printChain(os.Stdout, c)
+	}
+}
+
+// printChain prints the packages in chain c to w, one per line.
+func printChain(w io.Writer, c []edge) {
+	fmt.Fprintln(w, c[0].From)
+	for _, e := range c {
+		if e.Test {
+			fmt.Fprintln(w, e.To, "(test)")
+		} else {
+			fmt.Fprintln(w, e.To)
+		}
+	}
+}
+
+// adjacency returns the edges of g by the node they start from.
+func (g *graph) adjacency() map[string][]edge {
+	m := make(map[string][]edge)
+	for _, e := range g.Edges {
+		m[e.From] = append(m[e.From], e)
+	}
+	return m
+}
+
+// shortestChain returns a shortest chain of edges from any of
+// roots to a node for which match returns true, or nil if
+// there is none. Chains of build imports are preferred; chains
+// with test imports are returned only if there are no others.
+func (g *graph) shortestChain(roots []string, match func(string) bool) []edge {
+	adj := g.adjacency()
+	if c := searchChain(adj, roots, match, false); c != nil {
+		return c
+	}
+	return searchChain(adj, roots, match, true)
+}
+
+// searchChain does a breadth-first search for a shortest chain
+// of edges in adj from any of roots to a node for which match
+// returns true. Test edges are followed only if withTest is set.
+func searchChain(adj map[string][]edge, roots []string, match func(string) bool, withTest bool) []edge {
+	prev := make(map[string]edge)
+	seen := make(map[string]bool)
+	var queue []string
+	for _, r := range roots {
+		if !seen[r] {
+			seen[r] = true
+			queue = append(queue, r)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, e := range adj[n] {
+			if seen[e.To] || e.Test && !withTest {
+				continue
+			}
+			seen[e.To] = true
+			prev[e.To] = e
+			if match(e.To) {
+				var c []edge
+				for to := e.To; ; {
+					e, ok := prev[to]
+					if !ok {
+						break
+					}
+					c = append([]edge{e}, c...)
+					to = e.From
+				}
+				return c
+			}
+			queue = append(queue, e.To)
+		}
+	}
+	return nil
+}
+
+// allChains returns every chain of edges without cycles from
+// any of roots to a node for which match returns true.
+// Chains stop at the first matching node.
+func (g *graph) allChains(roots []string, match func(string) bool) [][]edge {
+	adj := g.adjacency()
+	var chains [][]edge
+	var c []edge
+	onChain := make(map[string]bool)
+	var visit func(n string)
+	visit = func(n string) {
+		onChain[n] = true
+		for _, e := range adj[n] {
+			if onChain[e.To] {
+				continue
+			}
+			c = append(c, e)
+			if match(e.To) {
+				chains = append(chains, append([]edge(nil), c...))
+			} else {
+				visit(e.To)
+			}
+			c = c[:len(c)-1]
+		}
+		onChain[n] = false
+	}
+	for _, r := range roots {
+		visit(r)
+	}
+	return chains
+}
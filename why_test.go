@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	g := &graph{
+		Nodes: []string{"C", "C/sub", "D/P", "D/Q", "E", "T"},
+		Edges: []edge{
+			{From: "C", To: "C/sub"},
+			{From: "C", To: "E", Test: true},
+			{From: "C/sub", To: "D/P"},
+			{From: "D/P", To: "D/Q"},
+			{From: "D/Q", To: "T"},
+			{From: "E", To: "T"},
+		},
+	}
+	roots := []string{"C"}
+	var cases = []struct {
+		target   string
+		shortest []edge
+		all      [][]edge
+	}{
+		{
+			target: "T",
+			shortest: []edge{ // build chain, though longer
+				{From: "C", To: "C/sub"},
+				{From: "C/sub", To: "D/P"},
+				{From: "D/P", To: "D/Q"},
+				{From: "D/Q", To: "T"},
+			},
+			all: [][]edge{
+				{
+					{From: "C", To: "C/sub"},
+					{From: "C/sub", To: "D/P"},
+					{From: "D/P", To: "D/Q"},
+					{From: "D/Q", To: "T"},
+				},
+				{
+					{From: "C", To: "E", Test: true},
+					{From: "E", To: "T"},
+				},
+			},
+		},
+		{
+			target: "D",
+			shortest: []edge{
+				{From: "C", To: "C/sub"},
+				{From: "C/sub", To: "D/P"},
+			},
+			all: [][]edge{
+				{
+					{From: "C", To: "C/sub"},
+					{From: "C/sub", To: "D/P"},
+				},
+			},
+		},
+		{
+			target: "E",
+			shortest: []edge{
+				{From: "C", To: "E", Test: true},
+			},
+			all: [][]edge{
+				{
+					{From: "C", To: "E", Test: true},
+				},
+			},
+		},
+		{
+			target: "X",
+		},
+	}
+	for _, test := range cases {
+		match := func(s string) bool {
+			return containsPathPrefix([]string{test.target}, s)
+		}
+		if c := g.shortestChain(roots, match); !reflect.DeepEqual(c, test.shortest) {
+			t.Errorf("shortestChain(%s) = %v want %v", test.target, c, test.shortest)
+		}
+		if c := g.allChains(roots, match); !reflect.DeepEqual(c, test.all) {
+			t.Errorf("allChains(%s) = %v want %v", test.target, c, test.all)
+		}
+	}
+}
+
+func TestWhyBuildImport(t *testing.T) {
+	// E is imported by C's tests, but is also a build dependency.
+	g := &graph{
+		Nodes: []string{"C", "D", "E"},
+		Edges: []edge{
+			{From: "C", To: "D"},
+			{From: "C", To: "E", Test: true},
+			{From: "D", To: "E"},
+		},
+	}
+	want := []edge{
+		{From: "C", To: "D"},
+		{From: "D", To: "E"},
+	}
+	match := func(s string) bool { return s == "E" }
+	if c := g.shortestChain([]string{"C"}, match); !reflect.DeepEqual(c, want) {
+		t.Errorf("shortestChain(E) = %v want %v", c, want)
+	}
+}